@@ -0,0 +1,203 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ARCHIVE_MANIFEST is the entry listing every image in the archive and how it was made
+const ARCHIVE_MANIFEST = "manifest.json"
+
+// archiveEntry is one image in the archive manifest
+type archiveEntry struct {
+	File           string  `json:"file"`
+	Prompt         string  `json:"prompt"`
+	NegativePrompt string  `json:"negative_prompt,omitempty"`
+	Model          string  `json:"model"`
+	StylePreset    string  `json:"style_preset,omitempty"`
+	Seed           int64   `json:"seed"`
+	CfgScale       float64 `json:"cfg_scale"`
+	Steps          int     `json:"steps"`
+	Width          int     `json:"width"`
+	Height         int     `json:"height"`
+	RequestID      string  `json:"request_id,omitempty"`
+}
+
+// archiveSink writes images into a single .zip or .tar.gz as they are saved. Every entry is
+// flushed to disk once written: a .tar.gz cut short still opens up to its last image, while
+// a .zip only gets its index when the archive is finished.
+type archiveSink struct {
+	mu       sync.Mutex
+	path     string
+	file     *os.File
+	zip      *zip.Writer
+	gz       *gzip.Writer
+	tar      *tar.Writer
+	logPath  string // the prompt log, added as logName when the archive is finished
+	logName  string
+	manifest []archiveEntry
+}
+
+// runArchive is the -archive sink, nil when images are saved as loose files
+var runArchive *archiveSink
+
+// archiveFormat tells the archive type from the filename: "zip", "tar.gz" or "" when unknown
+func archiveFormat(name string) string {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(lower, ".zip"):
+		return "zip"
+	case strings.HasSuffix(lower, ".tar.gz"), strings.HasSuffix(lower, ".tgz"):
+		return "tar.gz"
+	default:
+		return ""
+	}
+}
+
+func createArchive(archivePath string) (*archiveSink, error) {
+	format := archiveFormat(archivePath)
+	if format == "" {
+		return nil, fmt.Errorf("%s isn't a .zip, .tar.gz or .tgz file", archivePath)
+	}
+	f, err := os.Create(archivePath)
+	if err != nil {
+		return nil, fmt.Errorf("error creating archive: %v", err)
+	}
+
+	sink := &archiveSink{path: archivePath, file: f}
+	if format == "zip" {
+		sink.zip = zip.NewWriter(f)
+	} else {
+		sink.gz = gzip.NewWriter(f)
+		sink.tar = tar.NewWriter(sink.gz)
+	}
+	return sink, nil
+}
+
+// setupArchive sends the run's images into the -archive file instead of the output folder.
+// The prompt log is added once the run ends.
+func setupArchive(archivePath string, config *PromptConfig) error {
+	sink, err := createArchive(archivePath)
+	if err != nil {
+		return err
+	}
+	sink.logPath = filepath.Join(config.OutputDir, config.promptLogName())
+	sink.logName = imageKey(sink.logPath, config)
+	runArchive = sink
+	publishTargets = append(publishTargets, publishTarget{sink: sink, base: archivePath + ":"})
+	return nil
+}
+
+// Save adds data to the archive as name
+func (a *archiveSink) Save(ctx context.Context, name string, data []byte, meta Metadata) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return fmt.Errorf("archive %s is already closed", a.path)
+	}
+	if err := a.add(name, data, time.Now()); err != nil {
+		return fmt.Errorf("error adding %s to %s: %v", name, a.path, err)
+	}
+	a.manifest = append(a.manifest, archiveEntry{
+		File:           name,
+		Prompt:         meta.Prompt,
+		NegativePrompt: meta.NegativePrompt,
+		Model:          meta.Model,
+		StylePreset:    meta.StylePreset,
+		Seed:           meta.Seed,
+		CfgScale:       meta.CfgScale,
+		Steps:          meta.Steps,
+		Width:          meta.Width,
+		Height:         meta.Height,
+		RequestID:      meta.RequestID,
+	})
+	return nil
+}
+
+// add writes one entry and flushes it through to the file
+func (a *archiveSink) add(name string, data []byte, modified time.Time) error {
+	var w io.Writer
+	var err error
+	if a.zip != nil {
+		// Images are already compressed, so storing them is as small and much faster
+		method := zip.Deflate
+		if isAuditImage(name) {
+			method = zip.Store
+		}
+		w, err = a.zip.CreateHeader(&zip.FileHeader{Name: name, Method: method, Modified: modified})
+	} else {
+		err = a.tar.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(data)), ModTime: modified})
+		w = a.tar
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	if a.zip != nil {
+		err = a.zip.Flush()
+	} else if err = a.tar.Flush(); err == nil {
+		err = a.gz.Flush()
+	}
+	return err
+}
+
+// finish adds the prompt log and the manifest and closes the archive. It is safe to call
+// more than once.
+func (a *archiveSink) finish() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.file == nil {
+		return nil
+	}
+
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if a.logPath != "" {
+		if data, err := os.ReadFile(a.logPath); err == nil {
+			keep(a.add(a.logName, data, time.Now()))
+		}
+	}
+	manifest, err := json.MarshalIndent(a.manifest, "", "  ")
+	keep(err)
+	if err == nil {
+		keep(a.add(path.Join(path.Dir(a.logName), ARCHIVE_MANIFEST), manifest, time.Now()))
+	}
+
+	if a.zip != nil {
+		keep(a.zip.Close())
+	} else {
+		keep(a.tar.Close())
+		keep(a.gz.Close())
+	}
+	keep(a.file.Close())
+	a.file = nil
+	return firstErr
+}
+
+// finishArchive completes the -archive file, if there is one, once the prompt log is closed
+func finishArchive() {
+	if runArchive == nil {
+		return
+	}
+	if err := runArchive.finish(); err != nil {
+		displayError("Error finishing archive %s: %v", runArchive.path, err)
+	}
+}
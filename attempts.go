@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// attemptResult records what happened on one HTTP attempt for the attempt log
+type attemptResult struct {
+	status  int // 0 when no response was received
+	bytes   int64
+	started time.Time
+}
+
+// countingBody counts the response bytes read through it
+type countingBody struct {
+	io.ReadCloser
+	n *int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	*b.n += int64(n)
+	return n, err
+}
+
+// observe records the response status and counts the body as it is read
+func (a *attemptResult) observe(resp *http.Response) {
+	if a == nil {
+		return
+	}
+	a.status = resp.StatusCode
+	resp.Body = &countingBody{resp.Body, &a.bytes}
+}
+
+// logAttempt writes one line per HTTP attempt to the prompt log when LogAttempts is set,
+// failed attempts included, so missing images can be traced afterwards
+func logAttempt(config *PromptConfig, payload *GenerateRequest, retry int, attempt *attemptResult, err error) {
+	if !config.LogAttempts {
+		return
+	}
+
+	status := "no response"
+	if attempt.status != 0 {
+		status = fmt.Sprintf("HTTP %d", attempt.status)
+	}
+	line := fmt.Sprintf("\nAttempt %d:   %s, %d bytes, %s, request %s",
+		retry+1, status, attempt.bytes, time.Since(attempt.started).Round(time.Millisecond), payload.RequestID)
+	if apiKeyRing != nil && apiKeyRing.rotating() {
+		line += ", " + apiKeyRing.describe()
+	}
+	if err != nil {
+		line += fmt.Sprintf(" (%v)", err)
+	}
+	updatePromptLog([]string{line})
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// auditReport compares the images a prompt log lists with what is in the folder
+type auditReport struct {
+	Expected int
+	Found    int
+	Missing  []string
+	Empty    []string
+	Extra    []string
+}
+
+// runAuditCommand handles `venice audit [--log name] <dir>`
+func runAuditCommand(args []string) int {
+	auditFlags := flag.NewFlagSet("audit", flag.ExitOnError)
+	logName := auditFlags.String("log", DefaultPromptLogName, "Name of the prompt log in the folder")
+	auditFlags.Parse(args)
+
+	if auditFlags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: venice audit [--log PromptLog.txt] <dir>")
+		return 2
+	}
+
+	report, err := auditOutput(auditFlags.Arg(0), *logName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Audit failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("Expected %d images, found %d\n", report.Expected, report.Found)
+	printAuditList("Missing", report.Missing)
+	printAuditList("Empty", report.Empty)
+	printAuditList("Not in the log", report.Extra)
+
+	if len(report.Missing) > 0 || len(report.Empty) > 0 {
+		return 1
+	}
+	fmt.Println("All logged images are present")
+	return 0
+}
+
+func printAuditList(title string, files []string) {
+	if len(files) == 0 {
+		return
+	}
+	fmt.Printf("\n%s (%d):\n", title, len(files))
+	for _, file := range files {
+		fmt.Printf("  %s\n", file)
+	}
+}
+
+// auditOutput lists the files logged in dir's prompt log and checks each is on disk and
+// not empty. Images are matched by name without the extension so ones replaced by the
+// external encoder still count. Images in subfolders (style or part folders) that the log
+// doesn't mention are reported as extra.
+func auditOutput(dir string, logName string) (*auditReport, error) {
+	logged, err := loggedFiles(filepath.Join(dir, logName))
+	if err != nil {
+		return nil, err
+	}
+
+	// Every image on disk by its path relative to dir, without the extension
+	onDisk := make(map[string]string)
+	err = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() && entry.Name() == GALLERY_THUMBS {
+			return filepath.SkipDir
+		}
+		if entry.IsDir() || !isAuditImage(entry.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		onDisk[strings.TrimSuffix(rel, filepath.Ext(rel))] = rel
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", dir, err)
+	}
+
+	report := &auditReport{Expected: len(logged)}
+	seen := make(map[string]bool)
+	for _, file := range logged {
+		stem := strings.TrimSuffix(file, filepath.Ext(file))
+		seen[stem] = true
+
+		actual, ok := onDisk[stem]
+		if !ok {
+			report.Missing = append(report.Missing, file)
+			continue
+		}
+		report.Found++
+		if info, err := os.Stat(filepath.Join(dir, actual)); err == nil && info.Size() == 0 {
+			report.Empty = append(report.Empty, actual)
+		}
+	}
+
+	for stem, rel := range onDisk {
+		if !seen[stem] {
+			report.Extra = append(report.Extra, rel)
+		}
+	}
+	sort.Strings(report.Extra)
+	return report, nil
+}
+
+// isAuditImage reports whether name is an image, including the formats an external
+// encoder usually produces
+func isAuditImage(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".webp", ".avif", ".jxl", ".heic":
+		return true
+	default:
+		return isImageName(name, "")
+	}
+}
+
+// loggedFiles returns the "=====> File:" entries of a prompt log, once each
+func loggedFiles(logPath string) ([]string, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening prompt log: %v", err)
+	}
+	defer f.Close()
+
+	var files []string
+	seen := make(map[string]bool)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "=====> File:") {
+			continue
+		}
+		file := filepath.FromSlash(strings.TrimSpace(strings.TrimPrefix(line, "=====> File:")))
+		if file != "" && !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading prompt log: %v", err)
+	}
+	return files, nil
+}
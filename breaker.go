@@ -0,0 +1,81 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultBreakerThreshold = 5
+	DefaultBreakerCooldown  = 2 * time.Minute
+)
+
+// circuitBreaker stops sending requests while the API looks to be down. After threshold
+// consecutive server/network failures it opens for cooldown, then lets a single test
+// request through (half-open): success closes it again, failure reopens it.
+type circuitBreaker struct {
+	threshold   int
+	cooldown    time.Duration
+	consecutive int
+	openUntil   time.Time
+}
+
+var apiBreaker *circuitBreaker
+
+func newCircuitBreaker(config *PromptConfig) *circuitBreaker {
+	cb := &circuitBreaker{
+		threshold: config.BreakerThreshold,
+		cooldown:  DefaultBreakerCooldown,
+	}
+	if cb.threshold <= 0 {
+		cb.threshold = DefaultBreakerThreshold
+	}
+	if config.BreakerCooldown != "" {
+		if cooldown, err := time.ParseDuration(config.BreakerCooldown); err == nil && cooldown > 0 {
+			cb.cooldown = cooldown
+		}
+	}
+	return cb
+}
+
+// recordResult feeds the outcome of a request into the breaker. Only server and
+// network failures count, other API errors say nothing about availability.
+func (cb *circuitBreaker) recordResult(err error) {
+	if err == nil {
+		cb.consecutive = 0
+		return
+	}
+
+	if apiErr, ok := err.(*APIError); ok && apiErr.Class != ErrServer {
+		cb.consecutive = 0
+		return
+	}
+
+	cb.consecutive++
+	if cb.consecutive >= cb.threshold {
+		cb.openUntil = time.Now().Add(cb.cooldown)
+		updatePromptLog([]string{fmt.Sprintf("\n\nCircuit open after %d consecutive failures, pausing for %s", cb.consecutive, cb.cooldown)})
+	}
+}
+
+// wait blocks while the circuit is open, counting down in the progress display
+func (cb *circuitBreaker) wait(i int, config *PromptConfig) {
+	if cb.openUntil.IsZero() {
+		return
+	}
+
+	for !interrupted && !stopRequested() {
+		remaining := time.Until(cb.openUntil)
+		if remaining <= 0 {
+			break
+		}
+		updateProgress(i, config.NumImages, "", "",
+			fmt.Sprintf("API unavailable - testing again in %ds", int(remaining.Seconds()+0.5)),
+			config.Model, config.CfgScale)
+		time.Sleep(min(time.Second, remaining))
+	}
+
+	// Half-open: the next failure reopens the circuit straight away
+	cb.openUntil = time.Time{}
+	cb.consecutive = cb.threshold - 1
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// verifyImageFile fully decodes an image on disk to confirm it was written intact
+func verifyImageFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if _, _, err := image.Decode(f); err != nil {
+		return fmt.Errorf("%s is not a valid image: %v", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// checkImageDimensions reads just the image header to confirm the returned size matches
+// the requested Width/Height
+func checkImageDimensions(r io.Reader, config *PromptConfig) error {
+	imgConfig, _, err := image.DecodeConfig(r)
+	if err != nil {
+		return fmt.Errorf("unable to read image dimensions: %v", err)
+	}
+	if imgConfig.Width != config.Width || imgConfig.Height != config.Height {
+		return fmt.Errorf("image is %dx%d, requested %dx%d",
+			imgConfig.Width, imgConfig.Height, config.Width, config.Height)
+	}
+	return nil
+}
+
+// cleanOutputDir removes images under dir that fail to decode, along with temp files
+// left behind by interrupted streaming downloads, and reports what was removed
+func cleanOutputDir(dir string) int {
+	removed, checked := 0, 0
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+
+		name := d.Name()
+		if strings.HasPrefix(name, ".venice-") && strings.HasSuffix(name, ".tmp") {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			fmt.Printf("Removed partial download %s\n", path)
+			removed++
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(name)) {
+		case ".png", ".jpg", ".jpeg":
+		default:
+			return nil
+		}
+
+		checked++
+		if verifyErr := verifyImageFile(path); verifyErr != nil {
+			if err := os.Remove(path); err != nil {
+				return err
+			}
+			fmt.Printf("Removed %s (%v)\n", path, verifyErr)
+			removed++
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error cleaning %s: %v\n", dir, err)
+		return 1
+	}
+
+	fmt.Printf("\nChecked %d images, removed %d files\n", checked, removed)
+	return 0
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardPrompt is the base prompt read for -clipboard, empty when not in use
+var clipboardPrompt string
+
+// promptSource says where the base prompt came from with -clipboard, for the prompt log
+var promptSource string
+
+// clipboardCommands lists the commands that can print the clipboard on this platform,
+// in order of preference
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbpaste"}}
+	case "windows":
+		return [][]string{{"powershell", "-NoProfile", "-Command", "Get-Clipboard"}}
+	default:
+		return [][]string{
+			{"wl-paste", "--no-newline"},
+			{"xclip", "-selection", "clipboard", "-o"},
+			{"xsel", "--clipboard", "--output"},
+		}
+	}
+}
+
+// readClipboard returns the text on the system clipboard
+func readClipboard() (string, error) {
+	for _, command := range clipboardCommands() {
+		if _, err := exec.LookPath(command[0]); err != nil {
+			continue
+		}
+		out, err := exec.Command(command[0], command[1:]...).Output()
+		if err != nil {
+			return "", fmt.Errorf("%s failed: %v", command[0], err)
+		}
+		return strings.TrimSpace(string(out)), nil
+	}
+	return "", fmt.Errorf("no clipboard tool found (install wl-clipboard, xclip or xsel)")
+}
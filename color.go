@@ -0,0 +1,38 @@
+package main
+
+import "os"
+
+// ANSI color codes used by the progress display
+const (
+	ColorRed    = "31"
+	ColorGreen  = "32"
+	ColorYellow = "33"
+)
+
+// useColor reports whether output may be colored: not when NoColor or the NO_COLOR
+// environment variable (https://no-color.org) is set, or stdout isn't a terminal
+func useColor(config *PromptConfig) bool {
+	if config != nil && config.NoColor {
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return stdoutIsTerminal()
+}
+
+// colorize wraps text in the given ANSI color when color output is enabled
+func colorize(config *PromptConfig, code string, text string) string {
+	if !useColor(config) || text == "" {
+		return text
+	}
+	return "\033[" + code + "m" + text + "\033[0m"
+}
+
+// colorToggle shows an Enabled category in green and a Disabled one in red
+func colorToggle(config *PromptConfig, state string) string {
+	if state == "Enabled" {
+		return colorize(config, ColorGreen, state)
+	}
+	return colorize(config, ColorRed, state)
+}
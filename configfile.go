@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// JSONIndent is the indentation used for every JSON file written to ~/.venice
+const JSONIndent = "    "
+
+// formatJSON lays out JSON the same way for every file we write, whatever its source
+func formatJSON(data []byte) ([]byte, error) {
+	var compact bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := json.Indent(&out, compact.Bytes(), "", JSONIndent); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+	return out.Bytes(), nil
+}
+
+// marshalJSON is json.MarshalIndent with the shared layout
+func marshalJSON(v interface{}) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return formatJSON(data)
+}
+
+// configField is one top-level key of a JSON object, kept in file order
+type configField struct {
+	key   string
+	value json.RawMessage
+}
+
+// readConfigFields splits a JSON object into its top-level fields without interpreting
+// them, so fields this version doesn't know about survive a rewrite
+func readConfigFields(data []byte) ([]configField, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("config is not a JSON object")
+	}
+
+	var fields []configField
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, err
+		}
+		fields = append(fields, configField{tok.(string), value})
+	}
+	return fields, nil
+}
+
+// updateConfigFile sets one key in a JSON config file, keeping the existing key order
+// and any fields the PromptConfig struct doesn't define. A missing key is appended.
+func updateConfigFile(path, key string, value interface{}) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", path, err)
+	}
+	fields, err := readConfigFields(data)
+	if err != nil {
+		return fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("error encoding %s: %v", key, err)
+	}
+
+	found := false
+	for i := range fields {
+		if fields[i].key == key {
+			fields[i].value = raw
+			found = true
+		}
+	}
+	if !found {
+		fields = append(fields, configField{key, raw})
+	}
+
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, field := range fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(field.key)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(field.value)
+	}
+	buf.WriteByte('}')
+
+	out, err := formatJSON(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("error formatting %s: %v", path, err)
+	}
+	return os.WriteFile(path, out, 0644)
+}
+
+// storeAPIKey asks for an API key and saves it in the prompt config at configPath
+func storeAPIKey(configPath string) int {
+	if configPath == "" {
+		fmt.Fprintln(os.Stderr, "-store-key needs a config file to save the key in, not stdin")
+		return 1
+	}
+
+	fmt.Println("API Key: ")
+	sl := bufio.NewScanner(os.Stdin)
+	sl.Scan()
+	if err := sl.Err(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error reading API key: %v\n", err)
+		return 1
+	}
+	apiKey := strings.TrimSpace(sl.Text())
+	if apiKey == "" {
+		fmt.Fprintln(os.Stderr, "No API key entered")
+		return 1
+	}
+
+	if err := updateConfigFile(configPath, "api_key", apiKey); err != nil {
+		fmt.Fprintf(os.Stderr, "Error storing API key: %v\n", err)
+		return 1
+	}
+	fmt.Printf("API key saved to %s\n", configPath)
+	return 0
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// runDiffCommand handles `venice diff [--out dir] [--log name] <run A> <run B>`
+func runDiffCommand(args []string) int {
+	diffFlags := flag.NewFlagSet("diff", flag.ExitOnError)
+	outDir := diffFlags.String("out", "", "Folder for the comparison images (default <run B>_diff)")
+	logName := diffFlags.String("log", DefaultPromptLogName, "Name of the prompt log in each folder")
+	diffFlags.Parse(args)
+
+	if diffFlags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: venice diff [--out dir] [--log PromptLog.txt] <run A> <run B>")
+		return 2
+	}
+	dirA, dirB := diffFlags.Arg(0), diffFlags.Arg(1)
+	if *outDir == "" {
+		*outDir = filepath.Clean(dirB) + "_diff"
+	}
+
+	headerA, err := logHeader(filepath.Join(dirA, *logName))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Diff failed: %v\n", err)
+		return 1
+	}
+	headerB, err := logHeader(filepath.Join(dirB, *logName))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Diff failed: %v\n", err)
+		return 1
+	}
+	printHeaderDiff(headerA, headerB)
+
+	written, err := compareRuns(dirA, dirB, *logName, *outDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Diff failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("\nWrote %d comparison images to %s\n", written, *outDir)
+	return 0
+}
+
+// logField is one "Key: value" line of a prompt log header
+type logField struct {
+	key   string
+	value string
+}
+
+// logHeader returns the settings a run recorded at the top of its prompt log, up to the
+// first image entry
+func logHeader(logPath string) ([]logField, error) {
+	f, err := os.Open(logPath)
+	if err != nil {
+		return nil, fmt.Errorf("error opening prompt log: %v", err)
+	}
+	defer f.Close()
+
+	var fields []logField
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "=====> File:") {
+			break
+		}
+		if key, value, ok := strings.Cut(line, ":"); ok && !strings.HasPrefix(line, "Below") {
+			fields = append(fields, logField{strings.TrimSpace(key), strings.TrimSpace(value)})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading prompt log: %v", err)
+	}
+	return fields, nil
+}
+
+// printHeaderDiff lists the recorded settings that differ between two runs
+func printHeaderDiff(a, b []logField) {
+	valuesB := make(map[string]string)
+	for _, field := range b {
+		valuesB[field.key] = field.value
+	}
+
+	different := 0
+	seen := make(map[string]bool)
+	report := func(key, valueA, valueB string) {
+		if valueA == valueB {
+			return
+		}
+		if different == 0 {
+			fmt.Println("Settings that differ:")
+		}
+		different++
+		fmt.Printf("  %s\n    A: %s\n    B: %s\n", key, orNone(valueA), orNone(valueB))
+	}
+	for _, field := range a {
+		seen[field.key] = true
+		report(field.key, field.value, valuesB[field.key])
+	}
+	for _, field := range b {
+		if !seen[field.key] {
+			report(field.key, "", field.value)
+		}
+	}
+	if different == 0 {
+		fmt.Println("Both runs recorded the same settings")
+	}
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "(not set)"
+	}
+	return value
+}
+
+// compareRuns pairs the images of two runs in the order they were logged and writes a
+// comparison for each pair: run A, run B and, when the sizes match, a map of the pixels
+// that differ. It returns how many comparisons were written.
+func compareRuns(dirA, dirB, logName, outDir string) (int, error) {
+	filesA, err := loggedFiles(filepath.Join(dirA, logName))
+	if err != nil {
+		return 0, err
+	}
+	filesB, err := loggedFiles(filepath.Join(dirB, logName))
+	if err != nil {
+		return 0, err
+	}
+	if len(filesA) != len(filesB) {
+		fmt.Printf("\nRun A logged %d images and run B %d, comparing the first %d\n",
+			len(filesA), len(filesB), min(len(filesA), len(filesB)))
+	}
+
+	if err := os.MkdirAll(outDir, 0755); err != nil {
+		return 0, fmt.Errorf("error creating %s: %v", outDir, err)
+	}
+
+	written := 0
+	for i := 0; i < len(filesA) && i < len(filesB); i++ {
+		imgA, errA := loadRunImage(dirA, filesA[i])
+		imgB, errB := loadRunImage(dirB, filesB[i])
+		if errA != nil || errB != nil {
+			fmt.Printf("Skipping pair %d: %v\n", i+1, firstError(errA, errB))
+			continue
+		}
+
+		outPath := filepath.Join(outDir, fmt.Sprintf("compare-%d.png", i+1))
+		if err := writeComparison(outPath, imgA, imgB); err != nil {
+			return written, err
+		}
+		written++
+	}
+	return written, nil
+}
+
+func firstError(errs ...error) error {
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadRunImage decodes a logged image, also finding it when the external encoder has
+// replaced the PNG
+func loadRunImage(dir, logged string) (image.Image, error) {
+	path := filepath.Join(dir, logged)
+	if _, err := os.Stat(path); err != nil {
+		matches, _ := filepath.Glob(strings.TrimSuffix(path, filepath.Ext(path)) + ".*")
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("%s is missing", logged)
+		}
+		path = matches[0]
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("can't decode %s: %v", filepath.Base(path), err)
+	}
+	return img, nil
+}
+
+// writeComparison draws a and b side by side, followed by the difference between them
+// when they are the same size
+func writeComparison(path string, a, b image.Image) error {
+	boundsA, boundsB := a.Bounds(), b.Bounds()
+	panels := []image.Image{a, b}
+	if boundsA.Size() == boundsB.Size() {
+		panels = append(panels, pixelDiff(a, b))
+	}
+
+	width, height := 0, 0
+	for _, panel := range panels {
+		width += panel.Bounds().Dx()
+		height = max(height, panel.Bounds().Dy())
+	}
+
+	canvas := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(canvas, canvas.Bounds(), image.Black, image.Point{}, draw.Src)
+	x := 0
+	for _, panel := range panels {
+		bounds := panel.Bounds()
+		draw.Draw(canvas, image.Rect(x, 0, x+bounds.Dx(), bounds.Dy()), panel, bounds.Min, draw.Src)
+		x += bounds.Dx()
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", path, err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, canvas); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+// pixelDiff shows how much each pixel differs between two images of the same size:
+// identical pixels are black and the larger the difference the brighter the red
+func pixelDiff(a, b image.Image) image.Image {
+	boundsA, boundsB := a.Bounds(), b.Bounds()
+	diff := image.NewRGBA(image.Rect(0, 0, boundsA.Dx(), boundsA.Dy()))
+	for y := 0; y < boundsA.Dy(); y++ {
+		for x := 0; x < boundsA.Dx(); x++ {
+			r1, g1, b1, _ := a.At(boundsA.Min.X+x, boundsA.Min.Y+y).RGBA()
+			r2, g2, b2, _ := b.At(boundsB.Min.X+x, boundsB.Min.Y+y).RGBA()
+			delta := (absDiff(r1, r2) + absDiff(g1, g2) + absDiff(b1, b2)) / 3
+			// Scale up so small differences are still visible
+			level := min(255, (delta>>8)*4)
+			diff.Set(x, y, color.RGBA{uint8(level), 0, 0, 255})
+		}
+	}
+	return diff
+}
+
+func absDiff(a, b uint32) uint32 {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/csv"
+	"flag"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// runElementsCommand handles `venice elements import --category <name> <file>`
+func runElementsCommand(args []string) int {
+	if len(args) == 0 || args[0] != "import" {
+		fmt.Fprintln(os.Stderr, "Usage: venice elements import --category <name> <file.txt|file.csv>")
+		return 2
+	}
+
+	importFlags := flag.NewFlagSet("elements import", flag.ExitOnError)
+	category := importFlags.String("category", "", "Category to add the items to (e.g. clothing)")
+	importFlags.Parse(args[1:])
+
+	if *category == "" || importFlags.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: venice elements import --category <name> <file.txt|file.csv>")
+		return 2
+	}
+
+	added, err := importElements(*category, importFlags.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Import failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Added %d new items to %s\n", added, *category)
+	return 0
+}
+
+// readImportItems reads one item per line, or the first column of a CSV file
+func readImportItems(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.EqualFold(filepath.Ext(path), ".csv") {
+		return strings.Split(string(data), "\n"), nil
+	}
+
+	r := csv.NewReader(strings.NewReader(string(data)))
+	r.FieldsPerRecord = -1
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+
+	var items []string
+	weighted := false
+	for _, record := range records {
+		if len(record) == 0 {
+			continue
+		}
+		items = append(items, record[0])
+		weighted = weighted || len(record) > 1
+	}
+	if weighted {
+		fmt.Println("Note: elements have no weights yet, the extra CSV columns were ignored")
+	}
+	return items, nil
+}
+
+// importElements appends the items in path to a category of elements.json, skipping
+// blanks and anything already present. The rest of the file is left as it was.
+func importElements(category, path string) (int, error) {
+	var probe PromptElements
+	if _, err := categoryItems(&probe, category); err != nil {
+		return 0, err
+	}
+	key := strings.ToLower(category)
+	if key == "background" {
+		key = "backgrounds"
+	}
+
+	items, err := readImportItems(path)
+	if err != nil {
+		return 0, err
+	}
+
+	currentUser, err := user.Current()
+	if err != nil {
+		return 0, fmt.Errorf("error getting current user: %v", err)
+	}
+	elementsPath := filepath.Join(currentUser.HomeDir, ".venice", "elements.json")
+
+	// Items are written to elements.json itself, but ones an included file already has
+	// are skipped too
+	own, err := readElementsFile(elementsPath)
+	if err != nil {
+		return 0, err
+	}
+	existing, _ := categoryItems(own, key)
+	elements, err := loadPromptElements()
+	if err != nil {
+		return 0, err
+	}
+	all, _ := categoryItems(elements, key)
+
+	seen := make(map[string]bool)
+	for _, item := range all {
+		seen[strings.ToLower(strings.TrimSpace(item))] = true
+	}
+
+	merged := append([]string{}, existing...)
+	added := 0
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		if item == "" || seen[strings.ToLower(item)] {
+			continue
+		}
+		seen[strings.ToLower(item)] = true
+		merged = append(merged, item)
+		added++
+	}
+
+	if added == 0 {
+		return 0, nil
+	}
+	if err := updateConfigFile(elementsPath, key, merged); err != nil {
+		return 0, err
+	}
+	return added, nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// How long an external encoder may run on one image
+const ENCODER_TIMEOUT = 2 * time.Minute
+
+// encodedPath is where the external encoder writes its output for a saved PNG, or ""
+// when no encoder is configured
+func encodedPath(pngPath string, config *PromptConfig) string {
+	if config.ExternalEncoder == "" {
+		return ""
+	}
+	ext := config.EncoderExtension
+	if ext == "" {
+		ext = ".avif"
+	}
+	if !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return strings.TrimSuffix(pngPath, ".png") + ext
+}
+
+// encodeImageFile runs the ExternalEncoder command on a saved PNG. The command template
+// is split on spaces with {in} and {out} replaced by the PNG and output paths; it is
+// run directly, not through a shell. The PNG is removed once the encoder succeeds and
+// kept if it fails, so an encoder problem never loses an image. It returns the path of
+// the file that was kept.
+func encodeImageFile(pngPath string, config *PromptConfig) string {
+	outPath := encodedPath(pngPath, config)
+	if outPath == "" {
+		return pngPath
+	}
+
+	args := strings.Fields(config.ExternalEncoder)
+	if len(args) == 0 {
+		displayError("external_encoder has no command, keeping the PNG")
+		return pngPath
+	}
+	args[0] = expandPath(args[0], homeDir()) // e.g. "~/bin/avifenc"
+	for i, arg := range args {
+		arg = strings.ReplaceAll(arg, "{in}", pngPath)
+		args[i] = strings.ReplaceAll(arg, "{out}", outPath)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ENCODER_TIMEOUT)
+	defer cancel()
+
+	debugLog("Encoding image with %s...", args[0])
+	output, err := exec.CommandContext(ctx, args[0], args[1:]...).CombinedOutput()
+	if err == nil {
+		if info, statErr := os.Stat(outPath); statErr != nil || info.Size() == 0 {
+			err = fmt.Errorf("no output written to %s", outPath)
+		}
+	}
+	if err != nil {
+		os.Remove(outPath)
+		displayError("External encoder failed, keeping the PNG: %v %s", err, strings.TrimSpace(string(output)))
+		updatePromptLog([]string{"\nEncoder:     failed, kept PNG"})
+		return pngPath
+	}
+
+	os.Remove(pngPath)
+	updatePromptLog([]string{"\nEncoded:     ", outPath})
+	return outPath
+}
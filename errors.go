@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ErrorClass groups API failures by how they should be handled
+type ErrorClass int
+
+const (
+	ErrUnknown   ErrorClass = iota
+	ErrAuth                 // bad or missing API key, never worth retrying
+	ErrRateLimit            // back off and retry
+	ErrServer               // transient server side failure, retry
+	ErrContent              // the request itself was rejected (prompt, parameters)
+	ErrQuota                // out of credits or over the account's quota, stop the run
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case ErrAuth:
+		return "auth"
+	case ErrRateLimit:
+		return "rate-limit"
+	case ErrServer:
+		return "server"
+	case ErrContent:
+		return "content"
+	case ErrQuota:
+		return "quota"
+	default:
+		return "unknown"
+	}
+}
+
+// APIError is a non-200 response from the Venice API. Err, Detail and Details hold the
+// fields of a JSON error body when there is one; Message is the readable summary.
+type APIError struct {
+	StatusCode int
+	Message    string
+	Class      ErrorClass
+
+	Err     string
+	Detail  string
+	Details json.RawMessage
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("API error (Status %d, %s): %s", e.StatusCode, e.Class, e.Message)
+}
+
+// Retryable reports whether sending the same request again may succeed
+func (e *APIError) Retryable() bool {
+	switch e.Class {
+	case ErrRateLimit, ErrServer, ErrUnknown:
+		return true
+	default:
+		return false
+	}
+}
+
+func classifyStatus(statusCode int) ErrorClass {
+	switch {
+	case statusCode == 401 || statusCode == 403:
+		return ErrAuth
+	case statusCode == 402:
+		return ErrQuota
+	case statusCode == 429:
+		return ErrRateLimit
+	case statusCode >= 500:
+		return ErrServer
+	case statusCode == 400 || statusCode == 415 || statusCode == 422:
+		return ErrContent
+	default:
+		return ErrUnknown
+	}
+}
+
+// parseAPIError builds an APIError from a failed response, using the JSON error
+// fields when the body has them and the raw body otherwise
+func parseAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: statusCode,
+		Message:    string(body),
+		Class:      classifyStatus(statusCode),
+	}
+
+	var errorBody struct {
+		Error   string          `json:"error"`
+		Message string          `json:"message"`
+		Details json.RawMessage `json:"details"`
+	}
+	if err := json.Unmarshal(body, &errorBody); err == nil {
+		apiErr.Err = errorBody.Error
+		apiErr.Detail = errorBody.Message
+		if len(errorBody.Details) > 0 && string(errorBody.Details) != "null" {
+			apiErr.Details = errorBody.Details
+		}
+
+		switch {
+		case errorBody.Error != "" && errorBody.Message != "":
+			apiErr.Message = errorBody.Error + ": " + errorBody.Message
+		case errorBody.Error != "":
+			apiErr.Message = errorBody.Error
+		case errorBody.Message != "":
+			apiErr.Message = errorBody.Message
+		}
+		if apiErr.Details != nil {
+			apiErr.Message += fmt.Sprintf(" (%s)", apiErr.Details)
+		}
+	}
+
+	// A 429 can mean the account is out of quota rather than just going too fast
+	if apiErr.Class == ErrRateLimit && mentionsQuota(apiErr.Err+" "+apiErr.Detail) {
+		apiErr.Class = ErrQuota
+	}
+
+	return apiErr
+}
+
+func mentionsQuota(text string) bool {
+	text = strings.ToLower(text)
+	for _, word := range []string{"quota", "insufficient", "balance", "credits"} {
+		if strings.Contains(text, word) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// exportPrompts runs the prompt enhancement for NumImages images and writes the results
+// to a CSV file instead of generating anything. No API calls are made.
+func exportPrompts(path string, config *PromptConfig, elements *PromptElements) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", path, err)
+	}
+	defer f.Close()
+
+	resetElementDecks()
+	if config.EnhanceSeed != 0 {
+		seedElementSelection(config.EnhanceSeed)
+	}
+
+	w := csv.NewWriter(f)
+	w.Write([]string{"image", "seed", "cfg_scale", "model", "style_preset", "prompt", "negative_prompt"})
+
+	for i := 0; i < config.NumImages; i++ {
+		seed := randSource.ImageSeed(i)
+		if config.SeedElementsFromImage {
+			seedElementSelection(seed)
+		}
+
+		style, keyword := routeStyle(elements, config.pickStyle(elements, i))
+		prompt, _, _ := enhancePrompt(config.Prompt, config, elements, i, config.NumImages)
+		prompt = joinPromptParts(prompt, keyword)
+
+		w.Write([]string{
+			strconv.Itoa(i + 1),
+			strconv.FormatInt(seed, 10),
+			strconv.FormatFloat(config.nextCfgScale(), 'f', -1, 64),
+			config.Model,
+			style,
+			dedupPrompt(prompt),
+			config.negativePrompt(config.Model),
+		})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
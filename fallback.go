@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const DefaultFallbackAfter = 2
+
+// primaryFailStreak counts failures in a row on the configured model
+var primaryFailStreak = 0
+
+// fallbackSince is when the run switched to FallbackModel, zero while on the primary model
+var fallbackSince time.Time
+
+// fallbackCooldown is how long to stay on the fallback model, 0 meaning the rest of the run
+func (config *PromptConfig) fallbackCooldown() time.Duration {
+	if config.FallbackCooldown == "" {
+		return 0
+	}
+	cooldown, err := time.ParseDuration(config.FallbackCooldown)
+	if err != nil || cooldown < 0 {
+		return 0
+	}
+	return cooldown
+}
+
+// currentModel returns the model the next image should use, switching back to the
+// primary model once the fallback cooldown has passed
+func (config *PromptConfig) currentModel() string {
+	if config.FallbackModel == "" || fallbackSince.IsZero() {
+		return config.Model
+	}
+	if cooldown := config.fallbackCooldown(); cooldown > 0 && time.Since(fallbackSince) >= cooldown {
+		fallbackSince = time.Time{}
+		primaryFailStreak = 0
+		updatePromptLog([]string{"\nSwitching back to model ", config.Model, "\n"})
+		return config.Model
+	}
+	return config.FallbackModel
+}
+
+// noteModelResult tracks failures on the primary model and switches the run to the
+// fallback model once FallbackAfter of them happen in a row
+func noteModelResult(config *PromptConfig, model string, failed bool) {
+	if config.FallbackModel == "" || model != config.Model || !fallbackSince.IsZero() {
+		return
+	}
+	if !failed {
+		primaryFailStreak = 0
+		return
+	}
+
+	primaryFailStreak++
+	after := config.FallbackAfter
+	if after <= 0 {
+		after = DefaultFallbackAfter
+	}
+	if primaryFailStreak < after {
+		return
+	}
+
+	fallbackSince = time.Now()
+	// The fallback model gets a full failure allowance of its own
+	stats.ResetFailures()
+	message := fmt.Sprintf("%d failures in a row on %s - switching to fallback model %s",
+		primaryFailStreak, config.Model, config.FallbackModel)
+	updatePromptLog([]string{"\n", message, "\n"})
+	displayError("%s", message)
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"image"
+	"image/jpeg"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// GALLERY_THUMBS is the folder inside the gallery directory that holds the thumbnails
+const GALLERY_THUMBS = "_thumbs"
+
+// galleryEntry is one image on the gallery page
+type galleryEntry struct {
+	File   string // relative to the gallery folder, with forward slashes
+	Thumb  string // empty when the image couldn't be decoded
+	Prompt string
+	Seed   int64
+	Cfg    float64
+	Steps  int
+	Model  string
+	Style  string
+}
+
+func (e galleryEntry) CfgText() string {
+	if e.Cfg == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(e.Cfg, 'f', -1, 64)
+}
+
+// runGalleryCommand handles `venice gallery [--log name] [--size px] <dir>`
+func runGalleryCommand(args []string) int {
+	galleryFlags := flag.NewFlagSet("gallery", flag.ExitOnError)
+	logName := galleryFlags.String("log", DefaultPromptLogName, "Name of the prompt log in the folder")
+	size := galleryFlags.Int("size", 256, "Longest side of the thumbnails in pixels")
+	galleryFlags.Parse(args)
+
+	if galleryFlags.NArg() != 1 || *size < 16 {
+		fmt.Fprintln(os.Stderr, "Usage: venice gallery [--log PromptLog.txt] [--size 256] <dir>")
+		return 2
+	}
+	dir := galleryFlags.Arg(0)
+
+	entries, skipped, err := buildGallery(dir, *logName, *size)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Gallery failed: %v\n", err)
+		return 1
+	}
+	if len(entries) == 0 {
+		fmt.Fprintf(os.Stderr, "No images found in %s\n", dir)
+		return 1
+	}
+
+	indexPath := filepath.Join(dir, "index.html")
+	if err := writeGalleryPage(indexPath, filepath.Base(filepath.Clean(dir)), entries); err != nil {
+		fmt.Fprintf(os.Stderr, "Gallery failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Wrote %s with %d images\n", indexPath, len(entries))
+	if skipped > 0 {
+		fmt.Printf("%d image(s) couldn't be decoded and have no thumbnail\n", skipped)
+	}
+	return 0
+}
+
+// buildGallery collects every image under dir with what is known about how it was made
+// and makes a thumbnail for it. Thumbnails newer than their image are reused. It returns
+// the entries in filename order and how many images couldn't be thumbnailed.
+func buildGallery(dir string, logName string, size int) ([]galleryEntry, int, error) {
+	thumbDir := filepath.Join(dir, GALLERY_THUMBS)
+	var entries []galleryEntry
+	skipped := 0
+
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if path == thumbDir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !isAuditImage(entry.Name()) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+
+		item := galleryEntry{File: filepath.ToSlash(rel)}
+		if recipe, err := readImageRecipe(path, logName); err == nil {
+			item.Prompt, item.Seed, item.Cfg = recipe.Prompt, recipe.Seed, recipe.CfgScale
+			item.Steps, item.Model, item.Style = recipe.Steps, recipe.Model, recipe.StylePreset
+		}
+
+		thumbRel := filepath.Join(GALLERY_THUMBS, strings.TrimSuffix(rel, filepath.Ext(rel))+".jpg")
+		if err := writeThumbnail(path, filepath.Join(dir, thumbRel), size); err != nil {
+			skipped++
+		} else {
+			item.Thumb = filepath.ToSlash(thumbRel)
+		}
+		entries = append(entries, item)
+		return nil
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("error reading %s: %v", dir, err)
+	}
+
+	sort.Slice(entries, func(a, b int) bool { return entries[a].File < entries[b].File })
+	return entries, skipped, nil
+}
+
+// writeThumbnail saves a JPEG of the image scaled to fit size x size, unless an up to date
+// one is already there
+func writeThumbnail(imagePath, thumbPath string, size int) error {
+	info, err := os.Stat(imagePath)
+	if err != nil {
+		return err
+	}
+	if thumb, err := os.Stat(thumbPath); err == nil && thumb.ModTime().After(info.ModTime()) {
+		return nil
+	}
+
+	f, err := os.Open(imagePath)
+	if err != nil {
+		return err
+	}
+	img, _, err := image.Decode(f)
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(thumbPath), 0755); err != nil {
+		return err
+	}
+	out, err := os.Create(thumbPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return jpeg.Encode(out, scaleToFit(img, size), &jpeg.Options{Quality: 85})
+}
+
+// scaleToFit shrinks img so its longest side is at most size, averaging the source pixels
+// that fall in each thumbnail pixel. Smaller images are returned as they are.
+func scaleToFit(img image.Image, size int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= size && h <= size {
+		return img
+	}
+	tw, th := size, h*size/w
+	if h > w {
+		tw, th = w*size/h, size
+	}
+	tw, th = max(tw, 1), max(th, 1)
+
+	thumb := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for ty := 0; ty < th; ty++ {
+		y0, y1 := ty*h/th, max((ty+1)*h/th, ty*h/th+1)
+		for tx := 0; tx < tw; tx++ {
+			x0, x1 := tx*w/tw, max((tx+1)*w/tw, tx*w/tw+1)
+
+			var r, g, b, a, n uint64
+			for y := y0; y < y1; y++ {
+				for x := x0; x < x1; x++ {
+					pr, pg, pb, pa := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+					r, g, b, a = r+uint64(pr), g+uint64(pg), b+uint64(pb), a+uint64(pa)
+					n++
+				}
+			}
+			i := thumb.PixOffset(tx, ty)
+			thumb.Pix[i+0] = uint8(r / n >> 8)
+			thumb.Pix[i+1] = uint8(g / n >> 8)
+			thumb.Pix[i+2] = uint8(b / n >> 8)
+			thumb.Pix[i+3] = uint8(a / n >> 8)
+		}
+	}
+	return thumb
+}
+
+func writeGalleryPage(path string, title string, entries []galleryEntry) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("error creating %s: %v", path, err)
+	}
+	defer f.Close()
+
+	err = galleryTemplate.Execute(f, struct {
+		Title   string
+		Entries []galleryEntry
+	}{title, entries})
+	if err != nil {
+		return fmt.Errorf("error writing %s: %v", path, err)
+	}
+	return nil
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; background: #1e1e1e; color: #ddd; margin: 1em; }
+#sort { margin-bottom: 1em; }
+#grid { display: flex; flex-wrap: wrap; gap: 12px; }
+.card { width: 260px; background: #2a2a2a; border-radius: 6px; padding: 8px; font-size: 12px; }
+.card img { max-width: 100%; display: block; margin: 0 auto 6px; }
+.card .noimg { height: 120px; display: flex; align-items: center; justify-content: center; color: #888; }
+.prompt { color: #bbb; max-height: 8em; overflow: auto; }
+dt { float: left; clear: left; width: 4em; color: #888; }
+dd { margin-left: 4em; }
+a { color: #8cf; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div id="sort">Sort by:
+<select onchange="sortBy(this.value)">
+<option value="file">file</option>
+<option value="seed">seed</option>
+<option value="cfg">cfg</option>
+<option value="steps">steps</option>
+<option value="model">model</option>
+<option value="style">style</option>
+</select>
+</div>
+<div id="grid">
+{{range .Entries}}<div class="card" data-file="{{.File}}" data-seed="{{.Seed}}" data-cfg="{{.Cfg}}" data-steps="{{.Steps}}" data-model="{{.Model}}" data-style="{{.Style}}">
+<a href="{{.File}}">{{if .Thumb}}<img src="{{.Thumb}}" loading="lazy" alt="{{.File}}">{{else}}<div class="noimg">no preview</div>{{end}}</a>
+<div><a href="{{.File}}">{{.File}}</a></div>
+<dl>{{if .Seed}}<dt>seed</dt><dd>{{.Seed}}</dd>{{end}}{{if .Cfg}}<dt>cfg</dt><dd>{{.CfgText}}</dd>{{end}}{{if .Steps}}<dt>steps</dt><dd>{{.Steps}}</dd>{{end}}{{if .Model}}<dt>model</dt><dd>{{.Model}}</dd>{{end}}{{if .Style}}<dt>style</dt><dd>{{.Style}}</dd>{{end}}</dl>
+{{if .Prompt}}<div class="prompt">{{.Prompt}}</div>{{end}}
+</div>
+{{end}}</div>
+<script>
+function sortBy(key) {
+  var grid = document.getElementById("grid");
+  var cards = Array.prototype.slice.call(grid.children);
+  var numeric = key === "seed" || key === "cfg" || key === "steps";
+  cards.sort(function (a, b) {
+    var x = a.dataset[key], y = b.dataset[key];
+    if (numeric) return parseFloat(x) - parseFloat(y);
+    return x.localeCompare(y);
+  });
+  cards.forEach(function (card) { grid.appendChild(card); });
+}
+</script>
+</body>
+</html>
+`))
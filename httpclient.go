@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultConnectTimeout  = 10 * time.Second
+	DefaultTLSTimeout      = 10 * time.Second
+	DefaultRequestTimeout  = 60 * time.Second
+	DefaultMaxIdleConns    = 10
+	DefaultIdleConnTimeout = 90 * time.Second
+)
+
+// All API calls share one transport so its kept-alive connections are reused instead of
+// paying a new TCP and TLS handshake for every image
+var (
+	apiTransport     *http.Transport
+	apiTransportOnce sync.Once
+)
+
+// parseTimeout reads a duration setting, falling back to def when unset or invalid
+func parseTimeout(value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil || timeout <= 0 {
+		return def
+	}
+	return timeout
+}
+
+func (config *PromptConfig) requestTimeout() time.Duration {
+	return parseTimeout(config.RequestTimeout, DefaultRequestTimeout)
+}
+
+// sharedTransport returns the API transport, built from the config on first use. Its
+// connect and TLS handshake timeouts fail fast on a dead host.
+func sharedTransport(config *PromptConfig) *http.Transport {
+	apiTransportOnce.Do(func() {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.DialContext = (&net.Dialer{
+			Timeout:   parseTimeout(config.ConnectTimeout, DefaultConnectTimeout),
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+		transport.TLSHandshakeTimeout = parseTimeout(config.TLSTimeout, DefaultTLSTimeout)
+
+		transport.MaxIdleConns = DefaultMaxIdleConns
+		if config.MaxIdleConns > 0 {
+			transport.MaxIdleConns = config.MaxIdleConns
+		}
+		transport.MaxIdleConnsPerHost = transport.MaxIdleConns
+		transport.IdleConnTimeout = parseTimeout(config.IdleConnTimeout, DefaultIdleConnTimeout)
+
+		apiTransport = transport
+	})
+	return apiTransport
+}
+
+// newAPIClient returns a client on the shared transport. Clients are cheap, so each call
+// gets its own overall timeout while the connection pool is shared, which leaves room for
+// a slow generation without making the health check wait as long.
+func newAPIClient(config *PromptConfig, timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: sharedTransport(config)}
+}
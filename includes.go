@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// elementLists returns every category list of elements so they can be handled together
+func elementLists(elements *PromptElements) []*[]string {
+	return []*[]string{
+		&elements.Face, &elements.Type, &elements.Hair, &elements.Eyes, &elements.Clothing,
+		&elements.Style, &elements.StyleKeywords, &elements.Poses, &elements.Accessories,
+		&elements.Backgrounds, &elements.Dirty,
+	}
+}
+
+// readElementsFile parses one elements file without following its includes
+func readElementsFile(path string) (*PromptElements, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading elements file: %v", err)
+	}
+
+	var elements PromptElements
+	if err := json.Unmarshal(data, &elements); err != nil {
+		return nil, fmt.Errorf("error parsing elements file %s: %v", filepath.Base(path), err)
+	}
+	return &elements, nil
+}
+
+// loadElementsFile reads an elements file and merges in the files listed in its
+// "include", resolved relative to the including file. Included files may include others;
+// a file that ends up including itself is an error. chain holds the files being read.
+func loadElementsFile(path string, chain map[string]bool) (*PromptElements, error) {
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+	if chain[path] {
+		return nil, fmt.Errorf("%s includes itself", filepath.Base(path))
+	}
+	chain[path] = true
+	defer delete(chain, path)
+
+	elements, err := readElementsFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, include := range elements.Include {
+		includePath := include
+		if !filepath.IsAbs(includePath) {
+			includePath = filepath.Join(filepath.Dir(path), include)
+		}
+		included, err := loadElementsFile(includePath, chain)
+		if err != nil {
+			return nil, fmt.Errorf("error including %s: %v", include, err)
+		}
+		mergeElements(elements, included)
+	}
+	return elements, nil
+}
+
+// includedFiles lists the files an elements file includes, directly or through other
+// includes. Files that can't be read are still listed so they are noticed once created.
+func includedFiles(path string) []string {
+	var files []string
+	seen := map[string]bool{path: true}
+	var walk func(path string)
+	walk = func(path string) {
+		elements, err := readElementsFile(path)
+		if err != nil {
+			return
+		}
+		for _, include := range elements.Include {
+			if !filepath.IsAbs(include) {
+				include = filepath.Join(filepath.Dir(path), include)
+			}
+			if !seen[include] {
+				seen[include] = true
+				files = append(files, include)
+				walk(include)
+			}
+		}
+	}
+	walk(path)
+	return files
+}
+
+// mergeElements adds the items of src to dst category by category, skipping items dst
+// already has (ignoring case and surrounding spaces)
+func mergeElements(dst, src *PromptElements) {
+	dstLists, srcLists := elementLists(dst), elementLists(src)
+	for i := range dstLists {
+		seen := make(map[string]bool)
+		for _, item := range *dstLists[i] {
+			seen[strings.ToLower(strings.TrimSpace(item))] = true
+		}
+		for _, item := range *srcLists[i] {
+			key := strings.ToLower(strings.TrimSpace(item))
+			if !seen[key] {
+				seen[key] = true
+				*dstLists[i] = append(*dstLists[i], item)
+			}
+		}
+	}
+}
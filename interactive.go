@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+const (
+	UPSCALE_URL   = "https://api.venice.ai/api/v1/image/upscale"
+	UPSCALE_SCALE = 2
+)
+
+const interactiveHelp = `Type a prompt to generate an image, then:
+  <text>    refine: add the text to the prompt and generate again with the same seed
+  again     the same prompt with a new seed
+  up        upscale the current image 2x
+  save      keep the current image in the output folder
+  new       start over with a new prompt
+  quit      end the session (images that weren't saved are discarded)`
+
+// interactiveSession is the state of a -interactive run: the prompt built up so far and the
+// draft it last produced
+type interactiveSession struct {
+	config      *PromptConfig // generates into the drafts folder
+	baseConfig  *PromptConfig
+	currentUser *user.User
+	prompt      string
+	payload     GenerateRequest // the request behind the current draft
+	current     string          // the current draft image, "" before the first
+	drafts      int             // drafts generated, the image index for new seeds
+	saveDir     string          // the output folder, created on the first save
+	saved       int
+}
+
+// interactiveDrafts is the -interactive drafts folder, removed on Ctrl+C as well as on quit
+var interactiveDrafts string
+
+// runInteractive generates one image at a time from prompts typed at the terminal, keeping
+// drafts in a temporary folder until they are saved
+func runInteractive(config *PromptConfig, currentUser *user.User) {
+	drafts, err := os.MkdirTemp("", "venice-interactive-")
+	if err != nil {
+		displayError("Error creating drafts folder: %v", err)
+		return
+	}
+	interactiveDrafts = drafts
+	defer os.RemoveAll(drafts)
+	// Errors go to stderr between the prompts instead of into a progress display
+	quietMode = true
+
+	draftConfig := *config
+	draftConfig.OutputDir = drafts
+	draftConfig.NameAsSubDir = false
+	draftConfig.NumImages = 1
+	draftConfig.AppendToExisting, draftConfig.AppendPromptLog = false, false
+	draftConfig.GroupByStyle, draftConfig.MaxImagesPerDir = false, 0
+	draftConfig.ExternalEncoder = "" // upscaling needs the PNG
+	// Every draft needs its own file: skip would drop it and overwrite would replace the one
+	// being refined
+	draftConfig.CollisionStrategy = CollisionIncrement
+	if draftConfig.PromptName == "" {
+		draftConfig.PromptName = "interactive"
+	}
+	if err := initPromptLog(&draftConfig); err != nil {
+		displayError("Error initializing Prompt Log: %v", err)
+		return
+	}
+	defer closePromptLog()
+	activeConfig = &draftConfig
+
+	session := &interactiveSession{config: &draftConfig, baseConfig: config, currentUser: currentUser}
+	fmt.Println(interactiveHelp)
+
+	input := bufio.NewScanner(os.Stdin)
+	for !interrupted {
+		if session.current == "" {
+			fmt.Print("\nprompt> ")
+		} else {
+			fmt.Print("\nrefine, again, up, save, new or quit> ")
+		}
+		if !input.Scan() {
+			break
+		}
+		line := strings.TrimSpace(input.Text())
+		if line == "quit" || line == "exit" {
+			break
+		}
+		session.handle(line)
+		if abortReason == AbortAuth {
+			break
+		}
+	}
+
+	fmt.Printf("\n%d image(s) saved", session.saved)
+	if session.saveDir != "" {
+		fmt.Printf(" to %s", session.saveDir)
+	}
+	fmt.Println()
+}
+
+// handle carries out one line typed at the interactive prompt
+func (s *interactiveSession) handle(line string) {
+	switch {
+	case line == "":
+		return
+	case line == "help" || line == "?":
+		fmt.Println(interactiveHelp)
+	case line == "new":
+		s.prompt, s.current = "", ""
+	case s.current == "" && (line == "again" || line == "up" || line == "save"):
+		fmt.Println("Type a prompt first")
+	case s.current == "":
+		s.prompt = line
+		s.generate(false)
+	case line == "again":
+		s.generate(false)
+	case line == "up":
+		s.upscale()
+	case line == "save":
+		s.save()
+	default:
+		s.prompt = joinPromptParts(s.prompt, line)
+		s.generate(true)
+	}
+}
+
+// generate makes a draft of the session's prompt through the same request and storage path
+// as a batch run. A refinement keeps the seed and cfg of the current draft so only the
+// prompt changes.
+func (s *interactiveSession) generate(refine bool) {
+	if len(s.prompt) > MaxPromptLength {
+		displayError("Prompt is longer than %d characters", MaxPromptLength)
+		return
+	}
+	s.config.Prompt = s.prompt
+	payload := newGenerateRequest(s.config)
+	payload.Prompt = s.prompt
+	payload.StylePreset = s.config.StylePreset
+	if refine {
+		payload.Seed, payload.CfgScale = s.payload.Seed, s.payload.CfgScale
+	} else {
+		payload.Seed = randSource.ImageSeed(s.drafts)
+	}
+	s.drafts++
+
+	fmt.Printf("Generating (seed %d, cfg %.1f)...\n", payload.Seed, payload.CfgScale)
+	before := len(stats.Images())
+	requestImage(0, &payload, s.config)
+	flushPromptLog()
+
+	images := stats.Images()
+	if len(images) == before {
+		fmt.Println("No image this time - see the error above, then try again")
+		return
+	}
+	s.payload = payload
+	s.current = images[len(images)-1].File
+	fmt.Printf("Draft: %s\n", s.current)
+}
+
+// upscale replaces the current draft with an upscaled copy
+func (s *interactiveSession) upscale() {
+	fmt.Printf("Upscaling %dx...\n", UPSCALE_SCALE)
+	upscaled, err := upscaleImage(s.config, s.current, UPSCALE_SCALE)
+	if err != nil {
+		displayError("Upscale failed: %v", err)
+		return
+	}
+	s.current = upscaled
+	fmt.Printf("Draft: %s\n", s.current)
+}
+
+// save copies the current draft into the output folder with a .json sidecar holding its
+// request, so -from and the gallery know how it was made
+func (s *interactiveSession) save() {
+	if s.saveDir == "" {
+		dir, _, err := getOutputDirectory(s.baseConfig, s.currentUser)
+		if err != nil {
+			displayError("Error creating output directory: %v", err)
+			return
+		}
+		s.saveDir = dir
+	}
+
+	name := filepath.Base(s.current)
+	ext := filepath.Ext(name)
+	dest := filepath.Join(s.saveDir, name)
+	for n := 2; outputExists(dest, s.baseConfig); n++ {
+		dest = filepath.Join(s.saveDir, fmt.Sprintf("%s.%d%s", strings.TrimSuffix(name, ext), n, ext))
+	}
+
+	data, err := os.ReadFile(s.current)
+	if err == nil {
+		err = os.WriteFile(dest, data, 0644)
+	}
+	if err != nil {
+		displayError("Error saving image: %v", err)
+		return
+	}
+	if sidecar, err := json.MarshalIndent(s.payload, "", "  "); err == nil {
+		os.WriteFile(strings.TrimSuffix(dest, ext)+".json", sidecar, 0644)
+	}
+	s.saved++
+	fmt.Printf("Saved %s\n", dest)
+}
+
+// upscaleImage sends an image to the upscale endpoint and writes the result next to it
+// with an _x<scale> suffix, returning the new file
+func upscaleImage(config *PromptConfig, path string, scale int) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"image": base64.StdEncoding.EncodeToString(data),
+		"scale": scale,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error creating request: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(runCtx, "POST", UPSCALE_URL, bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("error creating HTTP request: %v", err)
+	}
+	requestID := newRequestID()
+	addAPIHeaders(req, config, requestID)
+	req.Header.Add("Content-Type", "application/json")
+
+	resp, err := newAPIClient(config, config.requestTimeout()).Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error sending request: %v", err)
+	}
+	defer resp.Body.Close()
+	result, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("error reading response: %v", err)
+	}
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("%v (request ID %s)", parseAPIError(resp.StatusCode, result), requestID)
+	}
+
+	// The image comes back as is, or base64 in JSON like a generate response
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var decoded GenerateResponse
+		if err := json.Unmarshal(result, &decoded); err != nil || len(decoded.Images) == 0 {
+			return "", fmt.Errorf("no image in the upscale response")
+		}
+		if result, err = decodeImageData(decoded.Images[0]); err != nil {
+			return "", fmt.Errorf("error decoding upscaled image: %v", err)
+		}
+	}
+
+	ext := filepath.Ext(path)
+	upscaled := fmt.Sprintf("%s_x%d%s", strings.TrimSuffix(path, ext), scale, ext)
+	if err := (fileSink{}).Save(runCtx, upscaled, result, Metadata{}); err != nil {
+		return "", fmt.Errorf("error saving upscaled image: %v", err)
+	}
+	return upscaled, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// How long a key is skipped after the API rate-limits or rejects it
+const (
+	KEY_RATE_LIMIT_REST = time.Minute
+	KEY_AUTH_REST       = 30 * time.Minute
+)
+
+// keyRing hands out the configured API keys round-robin, one per generate request,
+// skipping keys that are resting after a 401 or 429
+type keyRing struct {
+	mu        sync.Mutex
+	keys      []string
+	restUntil []time.Time
+	next      int
+	current   int // the key the last request was sent with
+}
+
+// apiKeyRing is built by setupAPIKeys before any request is sent
+var apiKeyRing *keyRing
+
+// newKeyRing uses APIKeys when set and falls back to the single APIKey
+func newKeyRing(config *PromptConfig) *keyRing {
+	var keys []string
+	for _, key := range config.APIKeys {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		keys = []string{config.APIKey}
+	}
+	return &keyRing{keys: keys, restUntil: make([]time.Time, len(keys))}
+}
+
+// setupAPIKeys builds the run's key ring. It runs in main before anything can start a
+// goroutine that sends requests.
+func setupAPIKeys(config *PromptConfig) {
+	apiKeyRing = newKeyRing(config)
+}
+
+// pick returns the next key that isn't resting. When every key is resting it returns the
+// one that comes back soonest rather than holding up the run.
+func (r *keyRing) pick(now time.Time) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	chosen := -1
+	for n := 0; n < len(r.keys); n++ {
+		index := (r.next + n) % len(r.keys)
+		if !now.Before(r.restUntil[index]) {
+			chosen = index
+			break
+		}
+	}
+	if chosen < 0 {
+		chosen = 0
+		for index := range r.keys {
+			if r.restUntil[index].Before(r.restUntil[chosen]) {
+				chosen = index
+			}
+		}
+	}
+	r.current, r.next = chosen, (chosen+1)%len(r.keys)
+	return r.keys[chosen]
+}
+
+// rest skips the current key for d
+func (r *keyRing) rest(d time.Duration, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.restUntil[r.current] = now.Add(d)
+}
+
+// healthy counts the keys that aren't resting
+func (r *keyRing) healthy(now time.Time) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	count := 0
+	for _, until := range r.restUntil {
+		if !now.Before(until) {
+			count++
+		}
+	}
+	return count
+}
+
+// rotating reports whether there is more than one key to rotate through
+func (r *keyRing) rotating() bool {
+	return len(r.keys) > 1
+}
+
+// describe names the current key for logs by its position and last characters
+func (r *keyRing) describe() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return fmt.Sprintf("key %d of %d (%s)", r.current+1, len(r.keys), maskKey(r.keys[r.current]))
+}
+
+// maskKey hides all but the last 4 characters of a key
+func maskKey(key string) string {
+	if len(key) <= 8 {
+		return "****"
+	}
+	return "****" + key[len(key)-4:]
+}
+
+// setAPIKey puts the next key in the generate request's Authorization header. Other calls
+// (status check, model list, upscale) keep the fixed APIKey from addAPIHeaders, so only
+// generate requests move the ring and describe() always names the key behind the last one.
+func setAPIKey(req *http.Request) {
+	if apiKeyRing == nil {
+		return
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKeyRing.pick(time.Now()))
+}
+
+// restAPIKey takes the key that just got a 401 or 429 out of rotation for a while and
+// reports whether another key is available to retry with straight away
+func restAPIKey(class ErrorClass) bool {
+	if apiKeyRing == nil || !apiKeyRing.rotating() {
+		return false
+	}
+	rest := KEY_RATE_LIMIT_REST
+	if class == ErrAuth {
+		rest = KEY_AUTH_REST
+	}
+	now := time.Now()
+	apiKeyRing.rest(rest, now)
+	displayError("Resting %s for %s", apiKeyRing.describe(), rest)
+	return apiKeyRing.healthy(now) > 0
+}
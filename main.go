@@ -4,30 +4,61 @@ import (
 	"bufio"
 	"bytes"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
-	"encoding/binary"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"math"
+	mrand "math/rand"
 	"net/http"
 	"os"
 	"os/signal"
 	"os/user"
 	"path/filepath"
+	"regexp"
+	"runtime"
+	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
+
+	"golang.org/x/term"
 )
 
 var lastError string
 
+// quietMode suppresses all TUI output (used when image bytes are written to stdout)
+var quietMode bool
+
+// fullScreen reports whether the cursor-addressed progress display is in use
+func fullScreen() bool {
+	return !quietMode && !*barMode
+}
+
+// activeConfig is the config driving the current batch, used by the progress display
+var activeConfig *PromptConfig
+
+// currentConfig returns the config of the running batch, or loads it from disk before one starts
+func currentConfig() *PromptConfig {
+	if activeConfig != nil {
+		return activeConfig
+	}
+	config, _ := initializeVeniceConfig()
+	return config
+}
+
 const (
+	VERSION         = "1.1.0"
 	API_URL         = "https://api.venice.ai/api/v1/image/generate"
 	RATE_LIMIT      = 2 * time.Second // Changed to exactly 2 seconds
 	emojisPerLine   = 35              // How many emojis fit per line
 	MaxPromptLength = 1250
 	MaxFilenameLen  = 200
+	MinImageSize    = 100_000 // anything smaller is treated as a failed generation
 
 	// Available image models
 	MODEL_FLUENTLY_XL         = "fluently-xl" // default, fastest
@@ -40,35 +71,60 @@ const (
 	// Use a single emoji type for consistency
 	DoneBox    = "✅" // or "█" for a solid block
 	PendingBox = "⬛" // or "░" for a lighter block
+
+	// Single-width alternatives for terminals/fonts where emoji render poorly
+	DoneBlock    = "█"
+	PendingBlock = "░"
+
+	// Plain ASCII for -ascii and terminals that can't render anything else
+	DoneASCII    = "#"
+	PendingASCII = "-"
 )
 
+// selectionRand drives element selection when an EnhanceSeed is configured so the whole
+// sequence of choices is reproducible; nil means the run's randSource
+var selectionRand *mrand.Rand
+
+func seedElementSelection(seed int64) {
+	selectionRand = mrand.New(newSelectionSource(seed, 0))
+}
+
 func getRandomItem(items []string) string {
 	if len(items) == 0 {
 		return ""
 	}
+	return items[selectionIntn(len(items))]
+}
 
-	// Use crypto/rand to generate index
-	var index uint64
-	b := make([]byte, 8)
-	rand.Read(b)
-	index = binary.BigEndian.Uint64(b)
+// selectionIntn returns a value in [0, n) from the element selection source
+func selectionIntn(n int) int {
+	if selectionRand != nil {
+		return selectionRand.Intn(n)
+	}
+	return randSource.Intn(n)
+}
 
-	return items[index%uint64(len(items))]
+// selectionFloat returns a value between 0 and 1 from the element selection source
+func selectionFloat() float64 {
+	if selectionRand != nil {
+		return selectionRand.Float64()
+	}
+	return randomFloat()
 }
 
-func generateCfgScale(minConfig, maxConfig float64) float64 {
-	// Generate random bytes
-	b := make([]byte, 8)
-	rand.Read(b)
+// randomFloat returns a value between 0 and 1 from the run's randSource
+func randomFloat() float64 {
+	return randSource.Float64()
+}
 
-	// Convert to float64 between 0 and 1
-	randomValue := float64(binary.BigEndian.Uint64(b)) / float64(math.MaxUint64)
+func generateCfgScale(minConfig, maxConfig, increment float64) float64 {
+	randomValue := randomFloat()
 
 	// Calculate CFG scale
 	cfgScale := minConfig + (randomValue * (maxConfig - minConfig))
 
-	// Round to nearest 0.25
-	roundedScale := math.Round(cfgScale*4) / 4
+	// Round to nearest increment
+	roundedScale := math.Round(cfgScale/increment) * increment
 
 	// Ensure we're within the specified range
 	if roundedScale < minConfig {
@@ -83,32 +139,161 @@ func generateCfgScale(minConfig, maxConfig float64) float64 {
 		roundedScale = 8.5 // default fallback
 	}
 
-	// Format to ensure exactly 2 decimal places and proper 0.25 increments
-	return math.Round(roundedScale*4) / 4
+	// Snap back onto the increment and drop floating point noise (e.g. 7.300000000000001)
+	return math.Round(math.Round(roundedScale/increment)*increment*1000) / 1000
+}
+
+const DefaultCfgIncrement = 0.25
+
+// cfgIncrement is the step random cfg scales are rounded to
+func (config *PromptConfig) cfgIncrement() float64 {
+	if config.CfgIncrement > 0 {
+		return config.CfgIncrement
+	}
+	return DefaultCfgIncrement
+}
+
+// nextCfgScale returns the cfg scale for the next image: CfgScale verbatim with FixedCfg,
+// otherwise a random value in MinConfig-MaxConfig
+func (config *PromptConfig) nextCfgScale() float64 {
+	if config.FixedCfg {
+		return config.CfgScale
+	}
+	return generateCfgScale(config.MinConfig, config.MaxConfig, config.cfgIncrement())
 }
 
 var wrLog *bufio.Writer
+var fPromptLog *os.File
+
+// logMu guards wrLog and fPromptLog, which the interrupt handler closes mid-run
+var logMu sync.Mutex
+
+const (
+	DefaultPromptLogName = "PromptLog.txt"
+	PROMPT_LOG_ROTATIONS = 3 // rotated logs kept as PromptLog.txt.1 (newest) to .3
+)
 
+// promptLogName returns the configured log filename; only the base name is used so the
+// log always lands in the output folder
+func (config *PromptConfig) promptLogName() string {
+	if config.PromptLogName == "" {
+		return DefaultPromptLogName
+	}
+	name := filepath.Base(os.ExpandEnv(config.PromptLogName))
+	if name == "." || name == string(filepath.Separator) {
+		return DefaultPromptLogName
+	}
+	return name
+}
+
+// rotatePromptLog moves an appended log that has grown past PromptLogMaxKB aside so the
+// next run starts a fresh file, keeping the last PROMPT_LOG_ROTATIONS logs
+func rotatePromptLog(promptLogPath string, config *PromptConfig) {
+	if config.PromptLogMaxKB <= 0 {
+		return
+	}
+	info, err := os.Stat(promptLogPath)
+	if err != nil || info.Size() < int64(config.PromptLogMaxKB)*1024 {
+		return
+	}
+
+	for n := PROMPT_LOG_ROTATIONS - 1; n > 0; n-- {
+		os.Rename(fmt.Sprintf("%s.%d", promptLogPath, n), fmt.Sprintf("%s.%d", promptLogPath, n+1))
+	}
+	if err := os.Rename(promptLogPath, promptLogPath+".1"); err != nil {
+		displayError("Error rotating Prompt Log: %v", err)
+	}
+}
+
+// initPromptLog starts the prompt log for a run. When appending to an existing folder the
+// previous runs' entries are kept and a separator marks where this run begins.
 func initPromptLog(config *PromptConfig) error {
-	var promptLogPath string
-	promptLogPath = filepath.Join(config.OutputDir, "PromptLog.txt")
-	fPromptLog, err := os.Create(promptLogPath)
+	closePromptLog()
+	logMu.Lock()
+	defer logMu.Unlock()
+
+	promptLogPath := filepath.Join(config.OutputDir, config.promptLogName())
+
+	var err error
+	var logLines []string
+	if config.AppendToExisting || config.AppendPromptLog {
+		rotatePromptLog(promptLogPath, config)
+		fPromptLog, err = os.OpenFile(promptLogPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			if info, err := fPromptLog.Stat(); err == nil && info.Size() > 0 {
+				logLines = append(logLines,
+					"\n\n================================================================================",
+					"\nRun started "+time.Now().Format("2006-01-02 15:04:05"),
+					"\n================================================================================\n")
+			}
+		}
+	} else {
+		fPromptLog, err = os.Create(promptLogPath)
+	}
 	if err != nil {
 		return err
 	}
 
 	wrLog = bufio.NewWriter(fPromptLog)
-	logLines := []string{
-		"Model: " + config.Model,
+	logLines = append(logLines,
+		"Model: "+config.Model,
 		fmt.Sprintf("\nImage count: %d", config.NumImages),
-		"\nPrompt Name: " + config.PromptName,
-		"\nBase Prompt: " + config.Prompt,
+		"\nPrompt Name: "+config.PromptName,
+		"\nBase Prompt: "+config.Prompt,
+		enhanceSeedLog(config),
+		deterministicLog(),
 		"\n\nBelow are the prompt enhancements for each image result.",
-		"\n--------------------------------------------------------------------------------"}
-	return updatePromptLog(logLines)
+		"\n--------------------------------------------------------------------------------")
+	return writePromptLog(logLines)
+}
+
+func flushPromptLog() {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if wrLog != nil {
+		wrLog.Flush()
+	}
+}
+
+// closePromptLog flushes and closes the current prompt log, if any
+func closePromptLog() {
+	logMu.Lock()
+	defer logMu.Unlock()
+	if wrLog != nil {
+		wrLog.Flush()
+		wrLog = nil
+	}
+	if fPromptLog != nil {
+		fPromptLog.Close()
+		fPromptLog = nil
+	}
+}
+
+func enhanceSeedLog(config *PromptConfig) string {
+	if config.EnhanceSeed == 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nEnhance Seed: %d", config.EnhanceSeed)
+}
+
+func deterministicLog() string {
+	if *deterministic < 0 {
+		return ""
+	}
+	return fmt.Sprintf("\nDeterministic: %d", *deterministic)
 }
 
 func updatePromptLog(newStrings []string) error {
+	logMu.Lock()
+	defer logMu.Unlock()
+	return writePromptLog(newStrings)
+}
+
+// writePromptLog is updatePromptLog for callers already holding logMu
+func writePromptLog(newStrings []string) error {
+	if wrLog == nil {
+		return nil
+	}
 	for i := 0; i < len(newStrings); i++ {
 		_, err := wrLog.WriteString(newStrings[i])
 		if err != nil {
@@ -122,9 +307,55 @@ func updatePromptLog(newStrings []string) error {
 	return nil
 }
 
-// Progress indicator lines
+// Progress indicator lines (with the default 5 prompt lines)
 const PROGRESS_LINES = 28
 
+const DefaultPromptLines = 5
+
+// promptLines is how many lines of the progress display the prompt may use
+func (config *PromptConfig) promptLines() int {
+	if config.PromptDisplayLines > 0 {
+		return config.PromptDisplayLines
+	}
+	return DefaultPromptLines
+}
+
+// progressLines is the height of the progress display
+func (config *PromptConfig) progressLines() int {
+	return PROGRESS_LINES - DefaultPromptLines + config.promptLines()
+}
+
+// wrapPrompt splits a comma separated prompt into lines of at most width characters,
+// keeping at most maxLines lines. It also returns how many prompt parts didn't fit.
+func wrapPrompt(prompt string, width, maxLines int) ([]string, int) {
+	words := strings.Split(prompt, ", ")
+	var lines []string
+	currentLine := ""
+
+	for i, word := range words {
+		testLine := currentLine
+		if len(currentLine) > 0 {
+			testLine += ", "
+		}
+		testLine += word
+
+		if len(testLine) > width && len(currentLine) > 0 {
+			lines = append(lines, currentLine)
+			if len(lines) >= maxLines {
+				return lines, len(words) - i
+			}
+			currentLine = word
+		} else {
+			currentLine = testLine
+		}
+	}
+
+	if len(currentLine) > 0 {
+		lines = append(lines, currentLine)
+	}
+	return lines, 0
+}
+
 type GenerateRequest struct {
 	Model          string  `json:"model"`
 	Prompt         string  `json:"prompt"`
@@ -137,11 +368,21 @@ type GenerateRequest struct {
 	CfgScale       float64 `json:"cfg_scale"`
 	NegativePrompt string  `json:"negative_prompt"`
 	Seed           int64   `json:"seed"`
+	Variants       int     `json:"variants,omitempty"`
 	StylePreset    string  `json:"style_preset,omitempty"`
+
+	// Sent as the X-Request-ID header rather than in the body
+	RequestID string `json:"-"`
+	// When set, names the saved file instead of the usual iteration/seed/scale name
+	FileLabel string `json:"-"`
+	// Appended to the filename just before the extension
+	FileSuffix string `json:"-"`
 }
 
 type GenerateResponse struct {
 	Images []string `json:"images"`
+
+	raw []byte // the undecoded body, kept for SaveRawResponse
 }
 
 type PromptConfig struct {
@@ -164,6 +405,151 @@ type PromptConfig struct {
 	Height         int     `json:"height"`
 	Steps          int     `json:"steps"`
 
+	// Refuse to write images anywhere outside this folder (~ and $VARS are expanded)
+	RestrictOutput string `json:"restrict_output,omitempty"`
+
+	// Folders under OutputDir resolved at run start, e.g. "{month}/{name}"
+	DirTemplate string `json:"dir_template,omitempty"`
+
+	// Save each image in a subfolder named after its style preset
+	GroupByStyle bool `json:"group_by_style,omitempty"`
+
+	// Images per folder before the run continues in part2, part3, ... subfolders (0 = no limit)
+	MaxImagesPerDir int `json:"max_images_per_dir,omitempty"`
+
+	// End prompt names cut to the maximum filename length in a hash of the full name
+	HashLongNames bool `json:"hash_long_names,omitempty"`
+
+	// What to do when an image's filename is already taken: "increment" (default),
+	// "timestamp", "overwrite" or "skip"
+	CollisionStrategy string `json:"collision_strategy,omitempty"`
+
+	// Add to an existing PromptName folder instead of creating a timestamped one
+	AppendToExisting bool `json:"append_to_existing,omitempty"`
+
+	// Prompt log filename in the output folder (default PromptLog.txt). With append_prompt_log
+	// each run is added to the log instead of replacing it, and a log past prompt_log_max_kb
+	// is rotated to <name>.1
+	PromptLogName   string `json:"prompt_log_name,omitempty"`
+	AppendPromptLog bool   `json:"append_prompt_log,omitempty"`
+	PromptLogMaxKB  int    `json:"prompt_log_max_kb,omitempty"`
+
+	// Failures allowed before the run is aborted, either as a count or a percentage of NumImages
+	MaxFailures       int     `json:"max_failures,omitempty"`
+	MaxFailurePercent float64 `json:"max_failure_percent,omitempty"`
+	// Successes in a row that forgive one earlier failure (default 5), or all of them
+	FailureDecay      int `json:"failure_decay,omitempty"`
+	FailureResetAfter int `json:"failure_reset_after,omitempty"`
+	// Times an image is regenerated when its base64 data fails to decode (default 2)
+	MaxDecodeRetries int `json:"max_decode_retries,omitempty"`
+	// Time allowed to connect and to complete the TLS handshake (default 10s each), and for
+	// the whole request including generation (default 60s)
+	ConnectTimeout string `json:"connect_timeout,omitempty"`
+	TLSTimeout     string `json:"tls_timeout,omitempty"`
+	RequestTimeout string `json:"request_timeout,omitempty"`
+	// Idle keep-alive connections kept open to the API (default 10) and how long an unused
+	// one stays open (default 90s); both are read once at the first request
+	MaxIdleConns    int    `json:"max_idle_conns,omitempty"`
+	IdleConnTimeout string `json:"idle_conn_timeout,omitempty"`
+
+	// Requests taking longer than SoftTimeout (e.g. "20s") are reported as slow; after
+	// SlowCancelAfter slow requests in a row, a slow request is cancelled and retried
+	SoftTimeout     string `json:"soft_timeout,omitempty"`
+	SlowCancelAfter int    `json:"slow_cancel_after,omitempty"`
+	// Command run on every saved PNG to convert it, e.g. "avifenc {in} {out}". The
+	// output (named with EncoderExtension, default ".avif") replaces the PNG on success.
+	ExternalEncoder  string `json:"external_encoder,omitempty"`
+	EncoderExtension string `json:"encoder_extension,omitempty"`
+	// Model used for the rest of the run (or FallbackCooldown, e.g. "10m") after
+	// FallbackAfter failures in a row on Model (default 2)
+	FallbackModel    string `json:"fallback_model,omitempty"`
+	FallbackAfter    int    `json:"fallback_after,omitempty"`
+	FallbackCooldown string `json:"fallback_cooldown,omitempty"`
+	// Random cfg scales are rounded to this step (default 0.25); FixedCfg uses CfgScale as is
+	CfgIncrement float64 `json:"cfg_increment,omitempty"`
+	FixedCfg     bool    `json:"fixed_cfg,omitempty"`
+	// Keep the undecoded API response as <image>.raw (or response-<request id>.raw when it
+	// can't be decoded) for debugging malformed images
+	SaveRawResponse bool `json:"save_raw_response,omitempty"`
+
+	// Log the status, size, latency and retry number of every HTTP attempt to PromptLog.txt
+	LogAttempts bool `json:"log_attempts,omitempty"`
+	// Pause for BatchPauseSec seconds after every BatchPauseEvery images, on top of the
+	// per-request rate limit
+	BatchPauseEvery int `json:"batch_pause_every,omitempty"`
+	BatchPauseSec   int `json:"batch_pause_sec,omitempty"`
+
+	// Turn off colors in the progress display (so does the NO_COLOR environment variable)
+	NoColor bool `json:"no_color,omitempty"`
+
+	// Attempts at one image before it is marked permanently failed and skipped (default 5)
+	MaxIndexAttempts int `json:"max_index_attempts,omitempty"`
+
+	// Request retries allowed across the whole run before it is aborted (<= 0, the default, means no limit)
+	RetryBudget int `json:"retry_budget,omitempty"`
+
+	// Reject and regenerate images whose size doesn't match Width/Height instead of only logging it
+	StrictDimensions bool `json:"strict_dimensions,omitempty"`
+
+	// Consecutive server/network failures that pause all requests for BreakerCooldown
+	BreakerThreshold int    `json:"breaker_threshold,omitempty"`
+	BreakerCooldown  string `json:"breaker_cooldown,omitempty"`
+
+	// Discord/Slack compatible webhook notified when a run completes, and on every
+	// failure with WebhookOnError
+	WebhookURL     string `json:"webhook_url,omitempty"`
+	WebhookOnError bool   `json:"webhook_on_error,omitempty"`
+
+	// Ask for the raw image bytes instead of base64 JSON; the response is streamed to disk
+	ReturnBinary bool `json:"return_binary,omitempty"`
+
+	// How many images each API call returns; each one counts toward NumImages
+	ImagesPerRequest int `json:"images_per_request,omitempty"`
+
+	// Several keys to rotate through, one per request; a key that gets a 401 or 429 is
+	// skipped for a while. APIKey is used when this is empty.
+	APIKeys []string `json:"api_keys,omitempty"`
+
+	// Overrides the default venice-cli/<version> User-Agent header
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// Drop the ancillary PNG chunks the API embedded (EXIF, timestamps, color profiles) but
+	// not the text the recipe is read back from, and/or tag images as sRGB in place of any
+	// color profile they came with
+	StripMetadata bool `json:"strip_metadata,omitempty"`
+	ForceSRGB     bool `json:"force_srgb,omitempty"`
+
+	// Upload finished images to an S3-compatible bucket, see S3Config
+	S3 *S3Config `json:"s3,omitempty"`
+
+	// Extra fields merged into every generate request, for API parameters this tool has no
+	// setting for yet. Fields the request already sends take precedence.
+	Extra map[string]json.RawMessage `json:"extra,omitempty"`
+
+	// How styles are chosen: "random", "none", "fixed" (always StylePreset) or "rotate"
+	// (cycle through StyleList). Unset falls back to the Style toggle.
+	StyleMode   string   `json:"style_mode,omitempty"`
+	StylePreset string   `json:"style_preset,omitempty"`
+	StyleList   []string `json:"style_list,omitempty"`
+
+	// How long errors stay on screen before continuing (e.g. "2s", "0s"; default 5s)
+	ErrorDwell string `json:"error_dwell,omitempty"`
+
+	// Lines of the progress display used for the prompt (default 5)
+	PromptDisplayLines int `json:"prompt_display_lines,omitempty"`
+
+	// Progress bar glyphs: "emoji" (default) or "blocks"
+	ProgressStyle string `json:"progress_style,omitempty"`
+	// Custom progress bar glyphs, taking precedence over ProgressStyle
+	ProgressDone    string `json:"progress_done,omitempty"`
+	ProgressPending string `json:"progress_pending,omitempty"`
+
+	// Clear the screen when the run ends (default true); false leaves the final progress on screen
+	ClearOnExit *bool `json:"clear_on_exit,omitempty"`
+
+	// How long the cached model list is trusted before refreshing (e.g. "24h")
+	ModelsCacheTTL string `json:"models_cache_ttl,omitempty"`
+
 	// Individual category toggles
 	EnableFace        bool `json:"enable_face"`
 	EnableType        bool `json:"enable_type"`
@@ -175,6 +561,32 @@ type PromptConfig struct {
 	EnableAccessories bool `json:"enable_accessories"`
 	EnableDirty       bool `json:"enable_dirty"`
 
+	// Generate every image twice at the same seed, with and without the negative prompt
+	AblateNegative bool `json:"ablate_negative,omitempty"`
+
+	// Seed element selection from each image's seed so the seed reproduces its elements too
+	SeedElementsFromImage bool `json:"seed_elements_from_image,omitempty"`
+
+	// Per-model negative prompts, falling back to NegativePrompt for unlisted models
+	NegativePromptsByModel map[string]string `json:"negative_prompts_by_model,omitempty"`
+
+	// Seeds element selection so a run's sequence of choices can be reproduced (0 = random)
+	EnhanceSeed int64 `json:"enhance_seed,omitempty"`
+
+	// Chance (0.0-1.0) that an enabled category contributes an element, keyed by category name
+	CategoryProbability map[string]float64 `json:"category_probability,omitempty"`
+
+	// Choose the random elements once and use them for every image in the batch
+	FixElementsPerBatch bool `json:"fix_elements_per_batch,omitempty"`
+
+	// Probability that moves linearly from the first to the second value over the run,
+	// e.g. {"accessories": [0.1, 0.9]}; takes precedence over CategoryProbability
+	CategoryRamp map[string][2]float64 `json:"category_ramp,omitempty"`
+
+	// Categories whose elements are dealt from a shuffled deck so none repeats within a
+	// batch until all have been used, e.g. {"hair": true}
+	UniqueAcrossBatch map[string]bool `json:"unique_across_batch,omitempty"`
+
 	// Display settings (for progress display)
 	DisplayFace        string `json:"display_face,omitempty"`
 	DisplayType        string `json:"display_type,omitempty"`
@@ -187,7 +599,97 @@ type PromptConfig struct {
 	DisplayDirty       string `json:"display_dirty,omitempty"`
 }
 
-var failedCount = 0
+const DefaultDecodeRetries = 2
+
+// maxDecodeRetries is how many times an image whose data fails to decode is regenerated
+func (config *PromptConfig) maxDecodeRetries() int {
+	if config.MaxDecodeRetries > 0 {
+		return config.MaxDecodeRetries
+	}
+	return DefaultDecodeRetries
+}
+
+const (
+	DefaultMaxFailures  = 3
+	DefaultFailureDecay = 5
+)
+
+// retryBudgetSpent reports whether the run has used up its retries, and if so makes it the
+// abortReason so the summary and webhook say why the run stopped. A budget <= 0 means no limit.
+func (config *PromptConfig) retryBudgetSpent() bool {
+	if config.RetryBudget <= 0 || stats.Retries() < config.RetryBudget {
+		return false
+	}
+	if abortReason == "" {
+		abortReason = AbortRetryBudget
+	}
+	return true
+}
+
+// abortReason is set when an error makes the rest of the run pointless (e.g. no quota left)
+var abortReason string
+
+// AbortAuth is the abortReason after the API rejected the key, which fails every request
+const AbortAuth = "API key rejected"
+
+// AbortQuota is the abortReason once the account is out of credits, which also fails
+// every request until it is topped up
+const AbortQuota = "API quota exhausted"
+
+// AbortRetryBudget is the abortReason once retry_budget is spent. Each queue entry gets a
+// fresh budget, so it only stops the entry that spent it.
+const AbortRetryBudget = "retry budget exhausted"
+
+// shouldStop reports whether the run has to end before the next image
+func (config *PromptConfig) shouldStop() bool {
+	return interrupted || stopRequested() || abortReason != "" || stats.Penalty() >= config.maxFailures() || config.retryBudgetSpent()
+}
+
+func recordFailure(err error) {
+	stats.RecordFailure()
+	notifyFailure(err)
+}
+
+// notifyFailure reports err to the webhook when WebhookOnError is set. It is sent before
+// carrying on, so the last failure of a run isn't lost when the process exits; the webhook's
+// short timeout bounds the wait.
+func notifyFailure(err error) {
+	if activeConfig != nil && activeConfig.WebhookOnError {
+		notifyWebhook(activeConfig, "failure", "⚠️ Venice generation failed: "+err.Error())
+	}
+}
+
+// resetRunCounters gives a new batch (a queue entry or a preview) a fresh failure and
+// retry allowance
+func resetRunCounters() {
+	stats.ResetAllowance()
+	if abortReason == AbortRetryBudget {
+		abortReason = ""
+	}
+	primaryFailStreak = 0
+	fallbackSince = time.Time{}
+}
+
+const DefaultMaxIndexAttempts = 5
+
+func (config *PromptConfig) maxIndexAttempts() int {
+	if config.MaxIndexAttempts > 0 {
+		return config.MaxIndexAttempts
+	}
+	return DefaultMaxIndexAttempts
+}
+
+// maxFailures returns how many failures abort the run. MaxFailurePercent scales the
+// limit with the run size and takes precedence over MaxFailures.
+func (config *PromptConfig) maxFailures() int {
+	if config.MaxFailurePercent > 0 {
+		return max(1, int(math.Ceil(float64(config.NumImages)*config.MaxFailurePercent/100)))
+	}
+	if config.MaxFailures > 0 {
+		return config.MaxFailures
+	}
+	return DefaultMaxFailures
+}
 
 type PromptElements struct {
 	// Base attributes
@@ -198,6 +700,10 @@ type PromptElements struct {
 	Clothing []string `json:"clothing"`
 	Style    []string `json:"style"`
 
+	// Styles that aren't API style presets (e.g. "Super Mario style") are picked like
+	// styles but added to the prompt text instead of being sent as style_preset
+	StyleKeywords []string `json:"style_keywords,omitempty"`
+
 	// Extra elements
 	Poses       []string `json:"poses"`
 	Accessories []string `json:"accessories"`
@@ -205,6 +711,9 @@ type PromptElements struct {
 
 	// Keep dirty the same
 	Dirty []string `json:"dirty"`
+
+	// Other element files (relative to this one) whose items are added to these
+	Include []string `json:"include,omitempty"`
 }
 
 func (config *PromptConfig) setDisplaySettings() {
@@ -226,6 +735,147 @@ func (config *PromptConfig) setDisplaySettings() {
 	config.DisplayDirty = setDisplay(config.EnableDirty)
 }
 
+func (config *PromptConfig) clearOnExit() bool {
+	return config.ClearOnExit == nil || *config.ClearOnExit
+}
+
+// leaveProgressDisplay ends the full-screen display, either clearing it or moving the
+// cursor below it so the final state stays visible
+func leaveProgressDisplay(config *PromptConfig) {
+	if config.clearOnExit() {
+		fmt.Print("\033[H\033[2J")
+		fmt.Println()
+		fmt.Println()
+		return
+	}
+	fmt.Printf("\033[%d;0H\n", config.progressLines()+1)
+}
+
+// progressGlyphs returns the done/pending glyphs for the configured style and
+// how many terminal columns each one occupies
+func (config *PromptConfig) progressGlyphs() (string, string, int) {
+	if *asciiMode {
+		return DoneASCII, PendingASCII, 1
+	}
+	if config.ProgressDone != "" || config.ProgressPending != "" {
+		done, pending := config.ProgressDone, config.ProgressPending
+		if done == "" {
+			done = DoneBox
+		}
+		if pending == "" {
+			pending = PendingBox
+		}
+		return done, pending, max(glyphWidth(done), glyphWidth(pending))
+	}
+	if config.ProgressStyle == "blocks" {
+		return DoneBlock, PendingBlock, 1
+	}
+	if !emojiTerminal() {
+		return DoneASCII, PendingASCII, 1
+	}
+	return DoneBox, PendingBox, 2
+}
+
+// emojiTerminal guesses whether the terminal can render emoji. Dumb terminals and the
+// legacy Windows console (anything outside Windows Terminal) can't.
+func emojiTerminal() bool {
+	if os.Getenv("TERM") == "dumb" {
+		return false
+	}
+	if runtime.GOOS == "windows" && os.Getenv("WT_SESSION") == "" {
+		return false
+	}
+	return true
+}
+
+// glyphWidth estimates how many terminal columns a progress glyph occupies, counting
+// emoji and East Asian wide characters as two
+func glyphWidth(glyph string) int {
+	width := 0
+	for _, r := range glyph {
+		switch {
+		case r == 0xFE0F:
+			// Emoji presentation selector, takes no space of its own
+		case r >= 0x1F000,
+			r >= 0x2E80 && r <= 0xA4CF,
+			r >= 0xAC00 && r <= 0xD7A3,
+			r >= 0xFF00 && r <= 0xFF60,
+			r == 0x2705, r == 0x274C, r == 0x2B1B, r == 0x2B1C, r == 0x2B50:
+			width += 2
+		default:
+			width++
+		}
+	}
+	return max(width, 1)
+}
+
+// progressBarLength scales the bar to the terminal so it never wraps, capped at
+// the width of the full emoji bar
+func progressBarLength(cellWidth int) int {
+	maxColumns := emojisPerLine * 2
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 && width-1 < maxColumns {
+		maxColumns = width - 1
+	}
+	length := maxColumns / cellWidth
+	if length < 1 {
+		length = 1
+	}
+	return length
+}
+
+// negativePrompt returns the negative prompt tuned for model, if any
+func (config *PromptConfig) negativePrompt(model string) string {
+	if negative, ok := config.NegativePromptsByModel[model]; ok {
+		return negative
+	}
+	return config.NegativePrompt
+}
+
+// pickStyle returns the style preset for image index according to StyleMode
+func (config *PromptConfig) pickStyle(elements *PromptElements, index int) string {
+	mode := config.StyleMode
+	if mode == "" {
+		mode = "none"
+		if config.Style {
+			mode = "random"
+		}
+	}
+
+	switch mode {
+	case "fixed":
+		return config.StylePreset
+	case "rotate":
+		styles := config.StyleList
+		if len(styles) == 0 {
+			styles = elements.allStyles()
+		}
+		if len(styles) == 0 {
+			return ""
+		}
+		return styles[index%len(styles)]
+	case "random":
+		return config.pickElement("STYLE", elements.allStyles())
+	default:
+		return ""
+	}
+}
+
+// allStyles returns the API style presets followed by the prompt text style keywords
+func (elements *PromptElements) allStyles() []string {
+	return append(append([]string{}, elements.Style...), elements.StyleKeywords...)
+}
+
+// routeStyle splits a picked style into the style_preset to send and the keyword to add to
+// the prompt. Entries of style_keywords go into the prompt, anything else is a preset.
+func routeStyle(elements *PromptElements, style string) (preset string, keyword string) {
+	for _, item := range elements.StyleKeywords {
+		if strings.EqualFold(item, style) {
+			return "", style
+		}
+	}
+	return style, ""
+}
+
 func clearErrorDisplay() {
 	// Move to the error display area (100 lines below the progress area)
 	fmt.Print("\033[100B")
@@ -237,35 +887,32 @@ func clearErrorDisplay() {
 	fmt.Print("\033[100A")
 }
 
+// loadPromptElements reads ~/.venice/elements.json and its includes. The elements are never
+// nil: on an error they are empty, so a run can carry on with just the base prompt.
 func loadPromptElements() (*PromptElements, error) {
 	currentUser, err := user.Current()
 	if err != nil {
-		return nil, fmt.Errorf("error getting current user: %v", err)
+		return &PromptElements{}, fmt.Errorf("error getting current user: %v", err)
 	}
 
 	elementsPath := filepath.Join(currentUser.HomeDir, ".venice", "elements.json")
-	data, err := os.ReadFile(elementsPath)
+	elements, err := loadElementsFile(elementsPath, make(map[string]bool))
 	if err != nil {
-		return nil, fmt.Errorf("error reading elements file: %v", err)
+		return &PromptElements{}, err
 	}
-
-	var elements PromptElements
-	if err := json.Unmarshal(data, &elements); err != nil {
-		return nil, fmt.Errorf("error parsing elements file: %v", err)
-	}
-
-	return &elements, nil
+	return elements, nil
 }
 
-func checkAPIStatus(apiKey string) error {
+func checkAPIStatus(config *PromptConfig) error {
 	req, err := http.NewRequest("GET", API_URL, nil)
 	if err != nil {
 		return fmt.Errorf("error creating health check request: %v", err)
 	}
 
-	req.Header.Add("Authorization", "Bearer "+apiKey)
+	requestID := newRequestID()
+	addAPIHeaders(req, config, requestID)
 
-	client := &http.Client{Timeout: 10 * time.Second}
+	client := newAPIClient(config, 10*time.Second)
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("API appears to be down: %v", err)
@@ -274,14 +921,15 @@ func checkAPIStatus(apiKey string) error {
 
 	if resp.StatusCode >= 500 {
 		body, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("API health check failed (Status %d): %s",
-			resp.StatusCode, string(body))
+		return fmt.Errorf("API health check failed (Status %d, request ID %s): %s",
+			resp.StatusCode, requestID, string(body))
 	}
 
 	return nil
 }
 
-func enhancePrompt(basePrompt string, config *PromptConfig, elements *PromptElements) (string, string, string) {
+// enhancePrompt adds the random category elements to basePrompt for image index of total
+func enhancePrompt(basePrompt string, config *PromptConfig, elements *PromptElements, index, total int) (string, string, string) {
 	var enhancementTypes []struct {
 		name    string
 		items   []string
@@ -308,35 +956,108 @@ func enhancePrompt(basePrompt string, config *PromptConfig, elements *PromptElem
 	var randomElements []string
 	for _, category := range enhancementTypes {
 		if category.enabled && len(category.items) > 0 {
-			if item := getRandomItem(category.items); item != "" {
+			if !config.categoryApplies(category.name, index, total) {
+				continue
+			}
+			if item := config.pickElement(category.name, category.items); item != "" {
 				randomElements = append(randomElements, strings.TrimSpace(item))
 			}
 		}
 	}
-	// Add "uncensored" to the prompt's random elements if Dirty is enabled
+	// Dirty contributes "uncensored" plus one of its elements, kept apart from the rest
+	// so they are added exactly once
+	var dirtyElements []string
 	if config.EnableDirty {
-		randomElements = append([]string{"uncensored"}, randomElements...)
+		dirtyElements = append(dirtyElements, "uncensored")
+		if item := config.pickElement("DIRTY", elements.Dirty); item != "" {
+			dirtyElements = append(dirtyElements, strings.TrimSpace(item))
+		}
 	}
 
-	// Now bring everything together into the fullPrompt variable
-	fullPrompt := basePrompt
-	if len(randomElements) > 0 {
-		if len(basePrompt) > 0 {
-			fullPrompt = basePrompt + ", " + strings.Join(randomElements, ", ")
-		} else {
-			fullPrompt = strings.Join(randomElements, ", ")
+	// Now bring everything together into the fullPrompt variable, dirty elements first
+	outRandos := strings.Join(randomElements, ", ")
+	outDirty := strings.Join(dirtyElements, ", ")
+	fullPrompt := joinPromptParts(basePrompt, outDirty, outRandos)
+	return fullPrompt, outRandos, outDirty
+}
+
+// joinPromptParts joins the non-empty parts of a prompt with commas
+func joinPromptParts(parts ...string) string {
+	var nonEmpty []string
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
 		}
 	}
+	return strings.Join(nonEmpty, ", ")
+}
 
-	// Separate the "dirty" elements from the rest
-	var dirtyElements []string
-	if config.EnableDirty {
-		dirtyElements = append([]string{"uncensored"}, elements.Dirty...)
+// dedupPrompt drops comma separated segments that repeat an earlier one (ignoring case
+// and surrounding spaces), so e.g. a base prompt and an element saying the same thing
+// only appear once
+func dedupPrompt(prompt string) string {
+	seen := make(map[string]bool)
+	var segments []string
+	dropped := false
+	for _, segment := range strings.Split(prompt, ",") {
+		key := strings.ToLower(strings.TrimSpace(segment))
+		if key != "" && seen[key] {
+			dropped = true
+			continue
+		}
+		seen[key] = true
+		segments = append(segments, segment)
+	}
+	// Leave the prompt exactly as written when there was nothing to remove
+	if !dropped {
+		return prompt
 	}
+	return strings.Join(segments, ",")
+}
 
-	outRandos := strings.Join(randomElements, ", ")
-	outDirty := strings.Join(dirtyElements, ", ")
-	return fullPrompt, outRandos, outDirty
+// categoryApplies rolls the configured probability for a category at image index of
+// total; categories without an entry are always applied
+func (config *PromptConfig) categoryApplies(name string, index, total int) bool {
+	for key, ramp := range config.CategoryRamp {
+		if strings.EqualFold(key, name) {
+			progress := 0.0
+			if total > 1 {
+				progress = float64(index) / float64(total-1)
+			}
+			return selectionFloat() < ramp[0]+(ramp[1]-ramp[0])*progress
+		}
+	}
+	for key, probability := range config.CategoryProbability {
+		if strings.EqualFold(key, name) {
+			return selectionFloat() < probability
+		}
+	}
+	return true
+}
+
+// newRequestID returns a random (version 4) UUID used to correlate a request with server logs
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func (config *PromptConfig) userAgent() string {
+	if config.UserAgent != "" {
+		return config.UserAgent
+	}
+	return fmt.Sprintf("venice-cli/%s (%s/%s)", VERSION, runtime.GOOS, runtime.GOARCH)
+}
+
+// addAPIHeaders sets the headers every API request carries: the key, the User-Agent and an
+// X-Request-ID that Venice support can find the request by. Generate requests then take
+// the next key in rotation with setAPIKey.
+func addAPIHeaders(req *http.Request, config *PromptConfig, requestID string) {
+	req.Header.Add("Authorization", "Bearer "+config.APIKey)
+	req.Header.Add("User-Agent", config.userAgent())
+	req.Header.Add("X-Request-ID", requestID)
 }
 
 func getUserAPIKey() (string, error) {
@@ -390,7 +1111,7 @@ func initializeVeniceConfig() (*PromptConfig, error) {
 				// Keep dirty the same
 				Dirty: []string{},
 			}
-			elementJSON, err := json.MarshalIndent(tmplateElements, "", "    ")
+			elementJSON, err := marshalJSON(tmplateElements)
 			if err != nil {
 				return nil, fmt.Errorf("error creating template elements: %v", err)
 			}
@@ -440,7 +1161,7 @@ func initializeVeniceConfig() (*PromptConfig, error) {
 			OutputDir:    filepath.Join(currentUser.HomeDir, "Pictures", "venice"),
 		}
 
-		configJSON, err := json.MarshalIndent(templateConfig, "", "    ")
+		configJSON, err := marshalJSON(templateConfig)
 		if err != nil {
 			return nil, fmt.Errorf("error creating template config: %v", err)
 		}
@@ -456,14 +1177,59 @@ func initializeVeniceConfig() (*PromptConfig, error) {
 		return nil, fmt.Errorf("error reading %s: %v", configPath, err)
 	}
 
+	return parseConfig(promptData, configPath)
+}
+
+// readStdinConfig loads the whole PromptConfig from standard input instead of prompt.json
+func readStdinConfig() (*PromptConfig, error) {
+	promptData, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config from stdin: %v", err)
+	}
+	if len(bytes.TrimSpace(promptData)) == 0 {
+		return nil, fmt.Errorf("no config on stdin, expected prompt.json content")
+	}
+	return parseConfig(promptData, "stdin")
+}
+
+// promptConfigPath is the prompt config the run uses: ~/.venice/prompt.json, the -config
+// file, or "" when it comes from stdin (-stdin or -config -)
+func promptConfigPath() string {
+	if *stdinConfig || *configFile == "-" {
+		return ""
+	}
+	if *configFile != "" {
+		return *configFile
+	}
+	return filepath.Join(os.Getenv("HOME"), ".venice", "prompt.json")
+}
+
+// readConfigFile reads the prompt config from path instead of ~/.venice/prompt.json
+func readConfigFile(path string) (*PromptConfig, error) {
+	promptData, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading config: %v", err)
+	}
+	return parseConfig(promptData, path)
+}
+
+// parseConfig unmarshals a PromptConfig from source, checks for an API key (falling back
+// to the VENICE_API_KEY environment variable) and fills in defaults
+func parseConfig(promptData []byte, source string) (*PromptConfig, error) {
 	var config PromptConfig
 	if err := json.Unmarshal(promptData, &config); err != nil {
-		return nil, fmt.Errorf("error parsing prompt.json: %v", err)
+		return nil, fmt.Errorf("error parsing config from %s: %v", source, err)
 	}
 
 	// Check for API key
 	if config.APIKey == "" || config.APIKey == "YOUR_API_KEY" {
-		return nil, fmt.Errorf("no API key found in config file %s", configPath)
+		config.APIKey = os.Getenv("VENICE_API_KEY")
+	}
+	if config.APIKey == "" && len(config.APIKeys) > 0 {
+		config.APIKey = config.APIKeys[0]
+	}
+	if config.APIKey == "" {
+		return nil, fmt.Errorf("no API key found in config %s or VENICE_API_KEY", source)
 	}
 
 	// Set defaults if not specified
@@ -473,12 +1239,9 @@ func initializeVeniceConfig() (*PromptConfig, error) {
 	if config.Height <= 0 {
 		config.Height = 1280
 	}
-	if config.Steps <= 5 {
-		config.Steps = 5
-	}
-	if config.Steps > 50 {
-		config.Steps = 50
-	}
+	// Only the widest bounds here; the model's own are checked, with a warning, once the
+	// flag overrides are in (see checkModelLimits)
+	config.Steps = min(max(config.Steps, defaultLimits.MinSteps), defaultLimits.MaxSteps)
 
 	return &config, nil
 }
@@ -491,40 +1254,51 @@ func updateProgress(current,
 	model string,
 	cfg float64) {
 
+	if quietMode {
+		return
+	}
+
+	if *barMode {
+		printProgressBar(current, total, status)
+		return
+	}
+
+	// Get the current config to access the base prompt and display settings
+	config := currentConfig()
+	basePrompt := config.Prompt
+
+	const maxLineWidth = 75
+	const indent = "          "
+	numLines := config.promptLines()
+
 	// Move to top
 	fmt.Print("\033[H")
 	// Clear progress area
-	for i := 0; i < PROGRESS_LINES; i++ {
+	for i := 0; i < config.progressLines(); i++ {
 		fmt.Print("\033[K\n")
 	}
 	// Move back to top
 	fmt.Print("\033[H")
 
-	const maxLineWidth = 75
-	const indent = "          "
-	const numLines = 5
-
 	// Progress percentage
 	percentage := int(float64(current+1) / float64(total) * 100)
-	fmt.Printf("Progress: [%d/%d] (%d%%)\033[K\n\n", current+1, total, percentage)
+	fmt.Printf("Progress: [%d/%d] (%d%%)   %s\033[K\n\n", current+1, total, percentage, progressETA(current, total))
 
-	// Print emojis based on emojisPerLine constant
-	numFilled := int(float64(percentage) / 100.0 * float64(emojisPerLine))
-	for i := 0; i < emojisPerLine; i++ {
+	// Scale the bar to the terminal width
+	doneGlyph, pendingGlyph, cellWidth := config.progressGlyphs()
+	barLength := progressBarLength(cellWidth)
+	numFilled := filledCells(percentage, barLength)
+	for i := 0; i < barLength; i++ {
 		if i < numFilled {
-			fmt.Print(DoneBox)
+			fmt.Print(doneGlyph)
 		} else {
-			fmt.Print(PendingBox)
+			fmt.Print(pendingGlyph)
 		}
 	}
 	fmt.Print("\033[K\n\n")
 
 	// Status and details
-	fmt.Printf("Status:   %s\033[K\n", status)
-
-	// Get the current config to access the base prompt
-	config, _ := initializeVeniceConfig()
-	basePrompt := config.Prompt
+	fmt.Printf("Status:   %s\033[K\n", colorize(config, ColorYellow, status))
 
 	// Print full prompt
 	fmt.Print("Prompt:   ")
@@ -537,50 +1311,21 @@ func updateProgress(current,
 		}
 	}
 
-	// Split and format the full prompt across lines
-	words := strings.Split(fullPrompt, ", ")
-	currentLine := ""
-	lineCount := 0
-
-	for i, word := range words {
-		testLine := currentLine
-		if len(currentLine) > 0 {
-			testLine += ", "
-		}
-		testLine += word
-
-		if len(testLine) > maxLineWidth-10 {
-			if len(currentLine) > 0 {
-				if lineCount == 0 {
-					fmt.Printf("%s\033[K\n", currentLine)
-				} else {
-					fmt.Printf("%s%s\033[K\n", indent, currentLine)
-				}
-				lineCount++
-				if lineCount >= numLines {
-					break
-				}
-			}
-			currentLine = word
+	// Split and format the full prompt across lines, flagging anything that didn't fit
+	lines, hidden := wrapPrompt(fullPrompt, maxLineWidth-10, numLines)
+	if hidden > 0 {
+		lines[len(lines)-1] += fmt.Sprintf(", …+%d more", hidden)
+	}
+	for i, line := range lines {
+		if i == 0 {
+			fmt.Printf("%s\033[K\n", line)
 		} else {
-			if len(currentLine) > 0 {
-				currentLine += ", "
-			}
-			currentLine += word
-		}
-
-		if i == len(words)-1 && len(currentLine) > 0 && lineCount < numLines {
-			if lineCount == 0 {
-				fmt.Printf("%s\033[K\n", currentLine)
-			} else {
-				fmt.Printf("%s%s\033[K\n", indent, currentLine)
-			}
-			lineCount++
+			fmt.Printf("%s%s\033[K\n", indent, line)
 		}
 	}
 
 	// Print remaining empty lines if needed
-	for i := lineCount; i < numLines; i++ {
+	for i := len(lines); i < numLines; i++ {
 		fmt.Printf("%s\033[K\n", indent)
 	}
 
@@ -589,34 +1334,93 @@ func updateProgress(current,
 	fmt.Printf("\033[K\n")
 	fmt.Printf("Model:    %s\033[K\n", model)
 	fmt.Printf("Style:    %s\033[K\n", style)
-	fmt.Printf("Config:   %.2f\033[K\n", math.Round(cfg*4)/4)
+	fmt.Printf("Config:   %.2f\033[K\n", cfg)
 	fmt.Printf("Output:   %s\033[K\n", config.OutputDir)
 	fmt.Printf("\033[K\n")
 
-	fmt.Printf("Face:     %s\033[K\n", config.DisplayFace)
-	fmt.Printf("Type:     %s\033[K\n", config.DisplayType)
-	fmt.Printf("Hair:     %s\033[K\n", config.DisplayHair)
-	fmt.Printf("Eyes:     %s\033[K\n", config.DisplayEyes)
-	fmt.Printf("Clothing: %s\033[K\n", config.DisplayClothing)
-	fmt.Printf("Backgrnd: %s\033[K\n", config.DisplayBackground)
-	fmt.Printf("Poses:    %s\033[K\n", config.DisplayPoses)
-	fmt.Printf("Accesry:  %s\033[K\n", config.DisplayAccessories)
-	fmt.Printf("Dirty:    %s\033[K\n", config.DisplayDirty)
+	fmt.Printf("Face:     %s\033[K\n", colorToggle(config, config.DisplayFace))
+	fmt.Printf("Type:     %s\033[K\n", colorToggle(config, config.DisplayType))
+	fmt.Printf("Hair:     %s\033[K\n", colorToggle(config, config.DisplayHair))
+	fmt.Printf("Eyes:     %s\033[K\n", colorToggle(config, config.DisplayEyes))
+	fmt.Printf("Clothing: %s\033[K\n", colorToggle(config, config.DisplayClothing))
+	fmt.Printf("Backgrnd: %s\033[K\n", colorToggle(config, config.DisplayBackground))
+	fmt.Printf("Poses:    %s\033[K\n", colorToggle(config, config.DisplayPoses))
+	fmt.Printf("Accesry:  %s\033[K\n", colorToggle(config, config.DisplayAccessories))
+	fmt.Printf("Dirty:    %s\033[K\n", colorToggle(config, config.DisplayDirty))
 
 	fmt.Printf("\033[K\n")
-	fmt.Printf("Failed:   %d\033[K\n", failedCount)
+	fmt.Printf("Failed:   %d\033[K\n", stats.Failed())
 
 	// Add error status line
 	errorStatus := "None"
 	if lastError != "" {
-		errorStatus = lastError
+		errorStatus = colorize(config, ColorRed, lastError)
 	}
 	fmt.Printf("Error:    %s\033[K\n", errorStatus)
 
 	// ToDo: Add error to output log file if debug is enabled in config
 }
 
+// filledCells is how many of a bar's length cells are done at percentage
+func filledCells(percentage, length int) int {
+	return int(float64(percentage) / 100.0 * float64(length))
+}
+
+// printProgressBar is the single-line alternative to the full-screen display, redrawn in
+// place with a carriage return. Without a terminal it degrades to one counter line per update.
+// barCurrent and barTotal are the last position drawn by printProgressBar
+var barCurrent, barTotal int
+
+// progressETA describes the time left for images current to total and the clock time
+// they should be done by
+func progressETA(current, total int) string {
+	eta, ok := stats.ETA(total - current)
+	if !ok {
+		return "ETA estimating..."
+	}
+	if eta >= time.Hour {
+		eta = eta.Round(time.Minute)
+	} else {
+		eta = eta.Round(time.Second)
+	}
+	return fmt.Sprintf("ETA %s (done ~%s)", eta, time.Now().Add(eta).Format("15:04"))
+}
+
+func printProgressBar(current, total int, status string) {
+	barCurrent, barTotal = current, total
+	percentage := int(float64(current+1) / float64(total) * 100)
+
+	if !stdoutIsTerminal() {
+		fmt.Printf("%d/%d (%d%%) %s %s\n", current+1, total, percentage, progressETA(current, total), status)
+		return
+	}
+
+	barLength := min(30, progressBarLength(1)/2)
+	numFilled := filledCells(percentage, barLength)
+	line := fmt.Sprintf("[%s%s] %d%% %d/%d %s %s",
+		strings.Repeat("#", numFilled),
+		strings.Repeat("-", barLength-numFilled),
+		percentage, current+1, total, progressETA(current, total), status)
+
+	// Pad over whatever was left from a longer previous line
+	fmt.Printf("\r%-*s", progressBarLength(1), line)
+}
+
 func displayError(format string, args ...interface{}) {
+	if *barMode && !quietMode {
+		lastError = fmt.Sprintf(format, args...)
+		fmt.Printf("\r%s\n", colorize(currentConfig(), ColorRed, fmt.Sprintf("%-*s", progressBarLength(1), "ERROR: "+lastError)))
+		updatePromptLog([]string{"\n\n❌ ERROR: ", lastError})
+		return
+	}
+
+	if quietMode {
+		lastError = fmt.Sprintf(format, args...)
+		fmt.Fprintf(os.Stderr, "ERROR: %s\n", lastError)
+		updatePromptLog([]string{"\n\n❌ ERROR: ", lastError})
+		return
+	}
+
 	// Clear previous error messages
 	clearErrorDisplay()
 
@@ -630,13 +1434,13 @@ func displayError(format string, args ...interface{}) {
 	fmt.Print("\033[100B")
 
 	// Print error
-	fmt.Printf("\n❌ ERROR: "+format+"\n", args...)
+	fmt.Printf("\n❌ %s\n", colorize(currentConfig(), ColorRed, "ERROR: "+lastError))
 
 	// Restore cursor position
 	fmt.Print("\033[u")
 
 	// Update the progress display to show the new error
-	config, _ := initializeVeniceConfig()
+	config := currentConfig()
 	current, total := 0, config.NumImages // Assuming these values are available
 	updateProgress(
 		current,
@@ -650,16 +1454,83 @@ func displayError(format string, args ...interface{}) {
 	// Set this to only write to log file if debug is set in prompt config
 	updatePromptLog([]string{"\n\n❌ ERROR: ", lastError})
 
-	// Pause to allow user to see the error
-	time.Sleep(5 * time.Second) // Pause for 5 seconds
+	// Pause to allow user to see the error, pointless when nobody is watching
+	if stdoutIsTerminal() {
+		time.Sleep(config.errorDwell())
+	}
 }
 
-func getOutputDirectory(config *PromptConfig, currentUser *user.User) (string, bool, error) {
-	outputDir := config.OutputDir
+func stdoutIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+const DefaultErrorDwell = 5 * time.Second
+
+// errorDwell is how long an error stays on screen before the run continues
+func (config *PromptConfig) errorDwell() time.Duration {
+	if config.ErrorDwell == "" {
+		return DefaultErrorDwell
+	}
+	dwell, err := time.ParseDuration(config.ErrorDwell)
+	if err != nil || dwell < 0 {
+		return DefaultErrorDwell
+	}
+	return dwell
+}
+
+// dirTemplatePlaceholder matches {placeholder} in DirTemplate
+var dirTemplatePlaceholder = regexp.MustCompile(`\{([a-z]+)\}`)
+
+// expandDirTemplate resolves the {date}, {month}, {year}, {model} and {name} placeholders
+// in a DirTemplate such as "{month}/{name}"
+func expandDirTemplate(template string, config *PromptConfig, now time.Time) (string, error) {
+	var unknown []string
+	expanded := dirTemplatePlaceholder.ReplaceAllStringFunc(template, func(match string) string {
+		switch match {
+		case "{date}":
+			return now.Format("2006-01-02")
+		case "{month}":
+			return now.Format("2006-01")
+		case "{year}":
+			return now.Format("2006")
+		case "{model}":
+			return config.Model
+		case "{name}":
+			return config.PromptName
+		default:
+			unknown = append(unknown, match)
+			return match
+		}
+	})
+	if len(unknown) > 0 {
+		return "", fmt.Errorf("unknown placeholder(s) in dir_template: %s", strings.Join(unknown, ", "))
+	}
+	return filepath.Clean(expanded), nil
+}
+
+// baseOutputDirectory is OutputDir with the DirTemplate folders, before any per-prompt subfolder
+func baseOutputDirectory(config *PromptConfig, currentUser *user.User) (string, error) {
+	outputDir := expandPath(config.OutputDir, currentUser.HomeDir)
 	if outputDir == "" {
 		outputDir = filepath.Join(currentUser.HomeDir, "Pictures", "venice")
 	}
 
+	if config.DirTemplate != "" {
+		templateDir, err := expandDirTemplate(config.DirTemplate, config, time.Now())
+		if err != nil {
+			return "", err
+		}
+		outputDir = filepath.Join(outputDir, templateDir)
+	}
+	return outputDir, nil
+}
+
+func getOutputDirectory(config *PromptConfig, currentUser *user.User) (string, bool, error) {
+	outputDir, err := baseOutputDirectory(config, currentUser)
+	if err != nil {
+		return "", false, err
+	}
+
 	useSubDir := false
 	if config.NameAsSubDir && config.PromptName != "" {
 		useSubDir = true
@@ -669,7 +1540,10 @@ func getOutputDirectory(config *PromptConfig, currentUser *user.User) (string, b
 		if os.IsNotExist(err) {
 			outputDir = tmpOutputDir
 		} else {
-			if oPathInfo.IsDir() {
+			if oPathInfo.IsDir() && config.AppendToExisting {
+				// Taken filenames are resolved by the collision strategy in imageFilename
+				outputDir = tmpOutputDir
+			} else if oPathInfo.IsDir() {
 				tStamp := time.Now().Unix()
 				outputDir = filepath.Join(outputDir, fmt.Sprintf("%s_%d", config.PromptName, tStamp))
 			} else {
@@ -678,6 +1552,9 @@ func getOutputDirectory(config *PromptConfig, currentUser *user.User) (string, b
 		}
 	}
 
+	if err := checkRestrictedOutput(outputDir, config, currentUser); err != nil {
+		return "", false, err
+	}
 	if err := os.MkdirAll(outputDir, 0755); err != nil {
 		return "", false, err
 	}
@@ -685,422 +1562,1417 @@ func getOutputDirectory(config *PromptConfig, currentUser *user.User) (string, b
 	return outputDir, useSubDir, nil
 }
 
-func generateFilenameAndLogDetail(config *PromptConfig, payload *GenerateRequest, iResult int) string {
+// cleanPrompt turns a prompt or name into something safe for a filename: anything
+// outside a-z, A-Z and 0-9 becomes an underscore, runs of underscores are collapsed and
+// the result is limited to MaxFilenameLen
+func cleanPrompt(prompt string) string {
+	return cleanName(prompt, false)
+}
+
+// cleanName is cleanPrompt with an optional hash: when hashLong is set, a name that has to
+// be truncated ends in a short hash of the whole name, so two names that only differ past
+// the cutoff don't end up with the same filename
+func cleanName(prompt string, hashLong bool) string {
+	// Replace spaces and special characters with underscores
+	s := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r
+		case r >= '0' && r <= '9':
+			return r
+		case r == ',':
+			return '_' // Explicitly convert commas to underscores
+		default:
+			return '_'
+		}
+	}, prompt)
+
+	// Replace multiple consecutive underscores with a single underscore
+	for strings.Contains(s, "__") {
+		s = strings.ReplaceAll(s, "__", "_")
+	}
+
+	// Trim leading/trailing underscores
+	s = strings.Trim(s, "_")
+
+	// Limit length to prevent extremely long filenames
+	return truncateName(s, MaxFilenameLen, hashLong)
+}
+
+// truncateName shortens name to at most max bytes, optionally ending it in an 8 character
+// hash of the full name. cleanName has already mapped the name to ASCII, so any byte is a
+// safe place to cut.
+func truncateName(name string, max int, hashLong bool) string {
+	if len(name) <= max {
+		return name
+	}
+
+	suffix := ""
+	if hashLong {
+		sum := sha256.Sum256([]byte(name))
+		suffix = "_" + hex.EncodeToString(sum[:])[:8]
+		max -= len(suffix)
+	}
+	return name[:max] + suffix
+}
+
+// Filename collision strategies
+const (
+	CollisionIncrement = "increment" // add a counter until the name is free
+	CollisionTimestamp = "timestamp" // append the current unix milliseconds
+	CollisionOverwrite = "overwrite" // replace the existing file
+	CollisionSkip      = "skip"      // keep the existing file and don't save the new one
+)
+
+// collisionStrategy returns the configured strategy, falling back to increment
+func (config *PromptConfig) collisionStrategy() string {
+	switch strings.ToLower(config.CollisionStrategy) {
+	case CollisionTimestamp, CollisionOverwrite, CollisionSkip:
+		return strings.ToLower(config.CollisionStrategy)
+	default:
+		return CollisionIncrement
+	}
+}
+
+// outputExists reports whether path, or the file the encoder would replace it with, exists
+func outputExists(path string, config *PromptConfig) bool {
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return true
+	}
+	encoded := encodedPath(path, config)
+	if encoded == "" {
+		return false
+	}
+	_, err := os.Stat(encoded)
+	return !os.IsNotExist(err)
+}
+
+// imageFilename returns the path image index iResult is saved to, resolving a taken name
+// with the collision strategy. It returns "" when the image should be skipped.
+func imageFilename(config *PromptConfig, payload *GenerateRequest, iResult int) string {
 	seed := payload.Seed
 	cfgScale := payload.CfgScale
-	stylePreset := payload.StylePreset
-	fullPrompt := payload.Prompt
 	promptName := config.PromptName
-	basePrompt := config.Prompt
 	usingSubDir := config.NameAsSubDir
 	outputDir := config.OutputDir
-	// Clean the prompt for filename use
-	cleanPrompt := func(prompt string) string {
-		// Replace spaces and special characters with underscores
-		s := strings.Map(func(r rune) rune {
-			switch {
-			case r >= 'a' && r <= 'z':
-				return r
-			case r >= 'A' && r <= 'Z':
-				return r
-			case r >= '0' && r <= '9':
-				return r
-			case r == ',':
-				return '_' // Explicitly convert commas to underscores
-			default:
-				return '_'
-			}
-		}, prompt)
 
-		// Replace multiple consecutive underscores with a single underscore
-		for strings.Contains(s, "__") {
-			s = strings.ReplaceAll(s, "__", "_")
+	// Sort images into a folder per style preset, unstyled ones stay in the root
+	styleDir := ""
+	if config.GroupByStyle && payload.StylePreset != "" {
+		if styleDir = cleanPrompt(payload.StylePreset); styleDir != "" {
+			outputDir = filepath.Join(outputDir, styleDir)
+			if err := os.MkdirAll(outputDir, 0755); err != nil {
+				displayError("Error creating style folder: %v", err)
+				outputDir, styleDir = config.OutputDir, ""
+			}
 		}
+	}
 
-		// Trim leading/trailing underscores
-		s = strings.Trim(s, "_")
-
-		// Limit length to prevent extremely long filenames
-		if len(s) > MaxFilenameLen {
-			s = s[:MaxFilenameLen]
+	// Continue in part2, part3, ... once the folder holds MaxImagesPerDir images
+	if config.MaxImagesPerDir > 0 {
+		partDir, err := rolloverDir(outputDir, config.MaxImagesPerDir, config)
+		if err != nil {
+			displayError("Error creating rollover folder: %v", err)
 		}
-		return s
+		outputDir = partDir
 	}
 
 	// Create filename with counter to avoid overwrites
-	counter := 0
 	imgNum := iResult + 1
-	iteration := fmt.Sprintf("%d.%d", imgNum, 0)
-	nameClean := cleanPrompt(promptName)
+	nameClean := cleanName(promptName, config.HashLongNames)
 	if usingSubDir {
 		nameClean = "image"
 	}
+	ext := payload.FileSuffix + ".png"
+
+	nameFor := func(counter int) string {
+		if payload.FileLabel != "" {
+			if counter > 0 {
+				return fmt.Sprintf("%s_seed%d.%d%s", cleanName(payload.FileLabel, config.HashLongNames), seed, counter, ext)
+			}
+			return fmt.Sprintf("%s_seed%d%s", cleanName(payload.FileLabel, config.HashLongNames), seed, ext)
+		}
+		if *seedSweep >= 0 {
+			// Seed sweeps are named by seed alone since everything else is fixed
+			if counter > 0 {
+				return fmt.Sprintf("%s-seed%d.%d%s", nameClean, seed, counter, ext)
+			}
+			return fmt.Sprintf("%s-seed%d%s", nameClean, seed, ext)
+		}
+		return fmt.Sprintf("%s-%d.%d_seed%d_scale%.1f%s", nameClean, imgNum, counter, seed, cfgScale, ext)
+	}
+
+	filename := nameFor(0)
+	switch config.collisionStrategy() {
+	case CollisionOverwrite:
+	case CollisionSkip:
+		if outputExists(filepath.Join(outputDir, filename), config) {
+			debugLog("Skipping %s, it already exists", filename)
+			return ""
+		}
+	case CollisionTimestamp:
+		if outputExists(filepath.Join(outputDir, filename), config) {
+			// Two images saved within the same millisecond still get a counter
+			stamped := fmt.Sprintf("%s_%d", strings.TrimSuffix(filename, ext), time.Now().UnixMilli())
+			filename = stamped + ext
+			for counter := 1; outputExists(filepath.Join(outputDir, filename), config); counter++ {
+				filename = fmt.Sprintf("%s.%d%s", stamped, counter, ext)
+			}
+		}
+	default:
+		for counter := 1; outputExists(filepath.Join(outputDir, filename), config); counter++ {
+			filename = nameFor(counter)
+		}
+	}
+	return filepath.Join(outputDir, filename)
+}
+
+func generateFilenameAndLogDetail(config *PromptConfig, payload *GenerateRequest, iResult int) string {
+	seed := payload.Seed
+	stylePreset := payload.StylePreset
+	fullPrompt := payload.Prompt
+	basePrompt := config.Prompt
+
+	fullFilePath := imageFilename(config, payload, iResult)
+	if fullFilePath == "" {
+		return ""
+	}
+	// Logged relative to the output folder so a style subfolder shows up
+	logName, err := filepath.Rel(config.OutputDir, fullFilePath)
+	if err != nil {
+		logName = filepath.Base(fullFilePath)
+	}
+
+	enhancedParts := strings.TrimPrefix(fullPrompt, basePrompt)
+	enhancedParts = strings.TrimPrefix(enhancedParts, ", ")
+	var logLines []string
+	logLines = append(logLines, "\n=====> File: ", logName)
+	if stylePreset != "" {
+		logLines = append(logLines, "\nImage Style: ", stylePreset)
+	}
+	if config.AblateNegative {
+		logLines = append(logLines, "\nNegative:    ", payload.NegativePrompt)
+	}
+	if config.SeedElementsFromImage {
+		logLines = append(logLines, fmt.Sprintf("\nSelect Seed: %d", seed))
+	}
+	if payload.RequestID != "" {
+		logLines = append(logLines, "\nRequest ID:  ", payload.RequestID)
+	}
+	if apiKeyRing != nil && apiKeyRing.rotating() {
+		logLines = append(logLines, "\nAPI Key:     ", apiKeyRing.describe())
+	}
+	if enhancedParts != "" {
+		logLines = append(logLines, "\nElements:    ", enhancedParts, "\n")
+	}
+	if err := updatePromptLog(logLines); err != nil {
+		return ""
+	}
+
+	return fullFilePath
+}
+
+func debugLog(format string, args ...interface{}) {
+	if !fullScreen() {
+		return
+	}
+	// Move to line right after progress display, whose height is the default until a
+	// config could be loaded
+	lines := PROGRESS_LINES
+	if config := currentConfig(); config != nil {
+		lines = config.progressLines()
+	}
+	fmt.Printf("\033[%d;0H", lines+1)
+	// Clear from cursor to end of line
+	fmt.Print("\033[K")
+	// Print debug message with timestamp
+	fmt.Printf("[%s] %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
+	// Return cursor to top for next progress update
+	fmt.Print("\033[H")
+}
+
+var interrupted bool
+
+// Command line flags
+var (
+	refreshModels     = flag.Bool("refresh-models", false, "Force a refetch of the available model list")
+	toStdout          = flag.Bool("stdout", false, "Generate a single image and write the raw PNG bytes to stdout")
+	deterministic     = flag.Int64("deterministic", -1, "Seed every random choice (cfg, elements, image seeds) from this value so runs repeat exactly")
+	seedSweep         = flag.Int64("seed-sweep", -1, "Generate one image per consecutive seed starting at this seed, with the prompt held fixed")
+	sweepCount        = flag.Int("sweep-count", 10, "Number of seeds to generate in -seed-sweep mode")
+	validateOnly      = flag.Bool("validate", false, "Validate the prompt config and elements.json without calling the API")
+	queueFile         = flag.String("watch", "", "Tail a queue file of JSON prompts (one per line) and generate each as it is appended")
+	listPresets       = flag.Bool("list-presets", false, "Generate one image per style preset with a fixed prompt and seed")
+	presetFilter      = flag.String("presets", "", "Comma separated subset of style presets for -list-presets")
+	sampleCategory    = flag.String("sample", "", "Generate one image per element of this category (e.g. hair) with the base prompt")
+	cleanDir          = flag.String("clean", "", "Remove images in this directory that fail to decode, then exit")
+	barMode           = flag.Bool("bar", false, "Show a single-line progress bar instead of the full-screen display")
+	stdinConfig       = flag.Bool("stdin", false, "Read the prompt config JSON from standard input instead of prompt.json")
+	showModels        = flag.Bool("models", false, "List the supported models with descriptions and exit")
+	imageCount        = flag.Int("n", 0, "Number of images to generate, overriding num_images in prompt.json")
+	enableCategories  = flag.String("enable", "", "Comma separated categories to enable for this run (e.g. hair,eyes)")
+	disableCategories = flag.String("disable", "", "Comma separated categories to disable for this run (e.g. dirty)")
+	noStyle           = flag.Bool("no-style", false, "Don't apply a style preset for this run")
+	jsonSummary       = flag.Bool("json", false, "Print a JSON summary of the run as the last line of output")
+	resumeRun         = flag.Bool("resume", false, "Continue the last interrupted run where it stopped, with the same element choices")
+	stopFile          = flag.String("stop-file", "", "Stop gracefully after the current image when this file appears (default ~/.venice/stop)")
+	profileRun        = flag.Bool("profile", false, "Time API requests, rate-limit sleeps and saving, and print where the run's time went")
+	interactive       = flag.Bool("interactive", false, "Generate one image at a time from prompts typed at the terminal, refining until it's right")
+	archiveFile       = flag.String("archive", "", "Write the run's images, PromptLog and a manifest into this .zip or .tar.gz instead of loose files")
+	asciiMode         = flag.Bool("ascii", false, "Draw the progress bar with plain ASCII (#/-)")
+	nativeSize        = flag.Bool("native", false, "Use the model's native width and height instead of the configured ones")
+	fromClipboard     = flag.Bool("clipboard", false, "Use the text on the clipboard as the base prompt")
+	watchConfig       = flag.Bool("watch-config", false, "Generate a preview image every time prompt.json or elements.json is saved")
+	skipIfRecent      = flag.Duration("skip-if-recent", 0, "Skip the run if the output folder has an image newer than this (e.g. 20h)")
+	exportFile        = flag.String("export-prompts", "", "Write num_images enhanced prompts to this CSV file without generating images, then exit")
+	storeKey          = flag.Bool("store-key", false, "Prompt for an API key, save it to the prompt config and exit")
+	fromImage         = flag.String("from", "", "Regenerate this image from its recorded prompt, style, seed and settings")
+	cfgOverride       = flag.Float64("cfg", 0, "Use this cfg scale for every image, overriding prompt.json")
+	stepsOverride     = flag.Int("steps", 0, "Number of steps, overriding prompt.json")
+	configFile        = flag.String("config", "", "Read the prompt config from this file instead of ~/.venice/prompt.json (- for stdin)")
+	outputFlag        = flag.String("output", "", "Save images under this folder, overriding output_dir")
+	quiet             = flag.Bool("quiet", false, "No progress display, errors go to stderr")
+	dimsFlag          = flag.String("dims", "", "Image size as WxH (e.g. 1024x768), overriding width and height")
+	testRun           = flag.Bool("test", false, "Generate one test image and ask before generating the rest of the batch")
+)
+
+func init() {
+	flag.IntVar(imageCount, "count", 0, "Same as -n")
+}
+
+// The -dims size once parsed
+var dimsWidth, dimsHeight int
+
+// parseDims reads a WxH size. Sides that aren't a multiple of 8 are rounded to the nearest
+// one, which is reported in the returned note.
+func parseDims(dims string) (int, int, string, error) {
+	w, h, ok := strings.Cut(strings.ToLower(strings.TrimSpace(dims)), "x")
+	width, errW := strconv.Atoi(strings.TrimSpace(w))
+	height, errH := strconv.Atoi(strings.TrimSpace(h))
+	if !ok || errW != nil || errH != nil {
+		return 0, 0, "", fmt.Errorf("%q is not a WxH size like 1024x768", dims)
+	}
+	if width <= 0 || height <= 0 {
+		return 0, 0, "", fmt.Errorf("width and height must be positive (got %dx%d)", width, height)
+	}
+
+	roundTo8 := func(n int) int { return max(8, (n+4)/8*8) }
+	note := ""
+	if width%8 != 0 || height%8 != 0 {
+		note = fmt.Sprintf("%dx%d is not a multiple of 8, using %dx%d", width, height, roundTo8(width), roundTo8(height))
+		width, height = roundTo8(width), roundTo8(height)
+	}
+	return width, height, note, nil
+}
+
+// applyFlagOverrides re-applies command line overrides to a freshly loaded config
+func applyFlagOverrides(config *PromptConfig) {
+	if clipboardPrompt != "" {
+		config.Prompt = clipboardPrompt
+	}
+	if *imageCount > 0 {
+		config.NumImages = *imageCount
+	}
+	if *toStdout {
+		config.NumImages = 1
+	}
+	if *nativeSize {
+		applyNativeDimensions(config)
+	}
+	if dimsWidth > 0 {
+		config.Width, config.Height = dimsWidth, dimsHeight
+	}
+	if *cfgOverride > 0 {
+		config.CfgScale = *cfgOverride
+		config.FixedCfg = true
+	}
+	if *stepsOverride > 0 {
+		config.Steps = *stepsOverride
+	}
+	applyCategoryFlags(config)
+}
+
+// sendGenerateRequest performs one API call. Non-200 responses are returned as *APIError.
+func sendGenerateRequest(client *http.Client, req *http.Request, attempt *attemptResult) (*GenerateResponse, error) {
+	debugLog("Starting API request...")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("HTTP request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	attempt.observe(resp)
+
+	debugLog("Got response, reading body...")
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response: %v", err)
+	}
+
+	debugLog("Read body: %d bytes", len(body))
+
+	if resp.StatusCode != 200 {
+		return nil, parseAPIError(resp.StatusCode, body)
+	}
+
+	result := GenerateResponse{raw: body}
+	if err := json.Unmarshal(body, &result); err != nil {
+		// The body is still returned so it can be saved for inspection
+		return &result, fmt.Errorf("error parsing API response: %v", err)
+	}
+	return &result, nil
+}
+
+// streamGenerateRequest performs one return_binary API call, copying the image straight
+// from the response body to a temp file that is renamed into place once complete so the
+// image is never held in memory. Non-200 responses are returned as *APIError.
+func streamGenerateRequest(i int, client *http.Client, req *http.Request, payload *GenerateRequest, config *PromptConfig, attempt *attemptResult) error {
+	debugLog("Starting API request...")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("HTTP request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	attempt.observe(resp)
+
+	if resp.StatusCode != 200 {
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return fmt.Errorf("error reading response: %v", err)
+		}
+		return parseAPIError(resp.StatusCode, body)
+	}
+
+	if *toStdout {
+		if _, err := io.Copy(os.Stdout, resp.Body); err != nil {
+			return fmt.Errorf("error writing image to stdout: %v", err)
+		}
+		stats.RecordSuccess(config)
+		lastError = ""
+		return nil
+	}
+
+	filename := generateFilenameAndLogDetail(config, payload, i)
+	if filename == "" && config.collisionStrategy() == CollisionSkip {
+		return nil
+	}
+	debugLog("Streaming image to disk...")
+
+	tmpFile, err := os.CreateTemp(filepath.Dir(filename), ".venice-*.tmp")
+	if err != nil {
+		return fmt.Errorf("error creating temp file: %v", err)
+	}
+	tmpPath := tmpFile.Name()
+
+	written, err := io.Copy(tmpFile, resp.Body)
+	if closeErr := tmpFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error streaming image: %v", err)
+	}
+
+	if written < MinImageSize {
+		os.Remove(tmpPath)
+		return fmt.Errorf("image too small (%d bytes)", written)
+	}
+
+	if err := verifyImageFile(tmpPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("streamed image failed verification: %v", err)
+	}
+
+	if f, err := os.Open(tmpPath); err == nil {
+		dimErr := checkImageDimensions(f, config)
+		f.Close()
+		if dimErr != nil && config.StrictDimensions {
+			os.Remove(tmpPath)
+			return fmt.Errorf("rejected image: %v", dimErr)
+		}
+		if dimErr != nil {
+			updatePromptLog([]string{"\nWarning:     ", dimErr.Error()})
+		}
+	}
+
+	if err := colorManageFile(tmpPath, config); err != nil {
+		debugLog("Error applying strip_metadata/force_srgb: %v", err)
+	}
+
+	if err := os.Rename(tmpPath, filename); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("error saving image: %v", err)
+	}
+
+	debugLog("Image Saved Successfully (%d bytes)", written)
+	countSavedImage(filename)
+	stats.RecordImage(publishImage(encodeImageFile(filename, config), config, imageMetadata(payload)), payload.Seed)
+	stats.RecordSuccess(config)
+	lastError = ""
+	return nil
+}
+
+func handleResponse(i int, payload *GenerateRequest, config *PromptConfig, client *http.Client, req *http.Request) int {
+	maxRetries := 3
+	retryDelay := 5 * time.Second
+
+	for retry := 0; retry < maxRetries; retry++ {
+		if retry > 0 {
+			if config.retryBudgetSpent() {
+				displayError("Retry budget of %d exhausted - stopping the run", stats.Retries())
+				return i
+			}
+			stats.RecordRetry()
+			displayError("Retrying request (attempt %d/%d)...", retry+1, maxRetries)
+			profileSleep(PhaseRetry, i, retryDelay)
+
+			// The first attempt consumed the body, so rewind it
+			if req.GetBody != nil {
+				req.Body, _ = req.GetBody()
+			}
+			setAPIKey(req)
+		}
+
+		if apiBreaker == nil {
+			apiBreaker = newCircuitBreaker(config)
+		}
+		breakerStart := time.Now()
+		apiBreaker.wait(i, config)
+		profileSince(PhaseRetry, i, breakerStart)
+		if stopRequested() {
+			return i
+		}
+
+		attemptReq, stopWatch := watchSlowRequest(req, config)
+		attempt := &attemptResult{started: time.Now()}
+
+		var result *GenerateResponse
+		var err error
+		if payload.ReturnBinary {
+			err = streamGenerateRequest(i, client, attemptReq, payload, config, attempt)
+		} else {
+			result, err = sendGenerateRequest(client, attemptReq, attempt)
+		}
+		profileSince(PhaseRequest, i, attempt.started)
+		if err != nil && interrupted {
+			return i // Cancelled by Ctrl+C, the shutdown takes it from here
+		}
+		logAttempt(config, payload, retry, attempt, err)
+		if _, cancelled := stopWatch(); cancelled {
+			displayError("Request passed the %s soft timeout after %d slow requests in a row - cancelling and retrying",
+				config.softTimeout(), config.SlowCancelAfter)
+			continue
+		}
+		apiBreaker.recordResult(err)
+		if err != nil {
+			recordFailure(err)
+			if result != nil {
+				saveRawResponse(config, payload, "", result.raw)
+			}
+
+			apiErr, ok := err.(*APIError)
+			noteModelResult(config, payload.Model, !ok || apiErr.Retryable())
+			if !ok {
+				// Network and read failures are treated as transient
+				displayError("%v (request ID %s)", err, payload.RequestID)
+				debugLog("Request failed")
+				profileSleep(PhaseRetry, i, 10*time.Second)
+				continue
+			}
+
+			displayError("%v (request ID %s)", apiErr, payload.RequestID)
+			updatePromptLog([]string{"\nFailed Request ID: ", payload.RequestID})
+
+			if apiErr.Class == ErrAuth || apiErr.Class == ErrRateLimit {
+				if restAPIKey(apiErr.Class) {
+					continue // Retry with another key instead of waiting on this one
+				}
+			}
+
+			switch apiErr.Class {
+			case ErrAuth:
+				// Every later request would fail the same way, so stop the whole run
+				abortReason = AbortAuth
+				displayError("Authentication failed - check your API key")
+				return i
+			case ErrContent:
+				// Resending the same prompt won't help, move on to the next image
+				stats.RecordBlocked()
+				displayError("Request rejected - skipping this prompt")
+				return i
+			case ErrQuota:
+				abortReason = AbortQuota
+				displayError("Quota exhausted - stopping the run")
+				return i
+			case ErrRateLimit:
+				displayError("Rate limit exceeded - waiting longer before retry")
+				profileSleep(PhaseRetry, i, RATE_LIMIT*2)
+			case ErrServer:
+				displayError("Server error - will retry")
+				profileSleep(PhaseRetry, i, 5*time.Second)
+			default:
+				displayError("Unexpected error occurred")
+				profileSleep(PhaseRetry, i, 10*time.Second)
+			}
+			continue
+		}
+
+		noteModelResult(config, payload.Model, false)
+
+		if payload.ReturnBinary {
+			break // Streamed straight to disk, nothing left to store
+		}
+		debugLog("Successfully parsed API response, processing %d images", len(result.Images))
+
+		// Make sure we capture any changes made to the iteration int during attempt to store the image.
+		// Images that couldn't be stored are regenerated by the caller via the returned index,
+		// so the same request is never sent again from here.
+		saveStart, index := time.Now(), i
+		i = storeImageResult(i, *result, payload, config)
+		profileSince(PhaseSave, index, saveStart)
+
+		debugLog("Completed processing this generation")
+
+		break // Success, exit retry loop
+	}
+
+	return i
+}
+
+// decodeImageData decodes base64 image data, ignoring any whitespace or line breaks in
+// it and accepting it without padding
+func decodeImageData(data string) ([]byte, error) {
+	data = strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\n', '\r':
+			return -1
+		}
+		return r
+	}, data)
+
+	decoded, err := base64.StdEncoding.DecodeString(data)
+	if err == nil {
+		return decoded, nil
+	}
+	if raw, rawErr := base64.RawStdEncoding.DecodeString(data); rawErr == nil {
+		return raw, nil
+	}
+	return nil, err
+}
+
+// base64Excerpt shortens undecodable image data to its first and last 64 characters
+// so it can be logged without writing megabytes to the log
+func base64Excerpt(data string) string {
+	if len(data) <= 160 {
+		return fmt.Sprintf("%q (%d chars)", data, len(data))
+	}
+	return fmt.Sprintf("%q ... %q (%d chars)", data[:64], data[len(data)-64:], len(data))
+}
+
+// storeImageResult saves every image in the response. Each stored image counts toward
+// NumImages, so the returned index is advanced past all of them; when nothing usable was
+// stored and the images were bad, it steps back so the index is retried.
+func storeImageResult(i int, result GenerateResponse, payload *GenerateRequest, config *PromptConfig) int {
+	stored := 0
+	retry := false
+	rawPath := "" // one response holds every image, so it is saved once, with the first
+	for _, imgData := range result.Images {
+		if i+stored >= config.NumImages {
+			break
+		}
+
+		debugLog("Decoding image data...")
+		imgBytes, err := decodeImageData(imgData)
+		if err != nil {
+			// Usually a truncated response, so regenerate rather than silently coming up short
+			displayError("Error decoding image data: %v", err)
+			debugLog("Failed to decode image data")
+			updatePromptLog([]string{"\nBad image data: ", base64Excerpt(imgData)})
+			saveRawResponse(config, payload, "", result.raw)
+			if stats.RecordDecodeFailure() <= config.maxDecodeRetries() {
+				retry = true
+			}
+			notifyFailure(fmt.Errorf("error decoding image data: %v", err))
+			continue
+		}
+		debugLog("Successfully decoded image (%d bytes)", len(imgBytes))
+
+		isAllBlack := true
+		for _, b := range imgBytes {
+			if b != 0 {
+				isAllBlack = false
+				break
+			}
+		}
+
+		if isAllBlack {
+			displayError("Generated image was all black, retrying...")
+			debugLog("Image was all black")
+			recordFailure(fmt.Errorf("generated image was all black"))
+			retry = true
+			continue
+		}
+
+		if len(imgBytes) < MinImageSize {
+			contentType := http.DetectContentType(imgBytes)
+			debugLog("Image too small or wrong format: %s, size: %d", contentType, len(imgBytes))
+			if contentType != "image/png" {
+				displayError("Unexpected file format: %s (expected PNG)", contentType)
+			}
+			recordFailure(fmt.Errorf("image too small (%d bytes, %s)", len(imgBytes), contentType))
+			retry = true
+			continue
+		}
+
+		dimErr := checkImageDimensions(bytes.NewReader(imgBytes), config)
+		if dimErr != nil && config.StrictDimensions {
+			displayError("Rejected image: %v", dimErr)
+			recordFailure(fmt.Errorf("rejected image: %v", dimErr))
+			retry = true
+			continue
+		}
+
+		filename := generateFilenameAndLogDetail(config, payload, i+stored)
+		if dimErr != nil {
+			debugLog("Dimension mismatch: %v", dimErr)
+			updatePromptLog([]string{"\nWarning:     ", dimErr.Error()})
+		}
+
+		if *toStdout {
+			if _, err := os.Stdout.Write(imgBytes); err != nil {
+				displayError("Error writing image to stdout: %v", err)
+				recordFailure(fmt.Errorf("error writing image to stdout: %v", err))
+				continue
+			}
+			stored++
+			stats.RecordSuccess(config)
+			lastError = ""
+			continue
+		}
+
+		if filename == "" && config.collisionStrategy() == CollisionSkip {
+			stored++
+			continue
+		}
+
+		debugLog("Attempting to save image...")
+		debugLog("File size: %d bytes", len(imgBytes))
+
+		if rawPath == "" {
+			rawPath = saveRawResponse(config, payload, filename, result.raw)
+		} else {
+			updatePromptLog([]string{"\nRaw Response: ", filepath.Base(rawPath)})
+		}
+		imgBytes = colorManageImage(imgBytes, config)
+		meta := imageMetadata(payload)
+		if err := localSink.Save(runCtx, filename, imgBytes, meta); err != nil {
+			displayError("Error saving image, retrying: %v", err)
+			debugLog("Failed to save image: %v", err)
+			recordFailure(fmt.Errorf("error saving image: %v", err))
+			retry = true
+			continue
+		}
+
+		debugLog("Image Saved Successfully")
+		countSavedImage(filename)
+		stats.RecordImage(publishImage(encodeImageFile(filename, config), config, meta), payload.Seed)
+		stored++
+		stats.RecordSuccess(config)
+		lastError = "" // Clear error status on success
+	}
+
+	if stored > 0 {
+		return i + stored - 1
+	}
+	if retry {
+		return i - 1
+	}
+	return i
+}
+
+// generateBatch runs the generation loop for config.NumImages images. When configPath is
+// set, edits to that file are picked up between images.
+func generateBatch(config *PromptConfig, elements *PromptElements, configPath string) {
+	sweeping := *seedSweep >= 0
+	activeConfig = config
+	if !continuingBatch {
+		resetElementDecks()
+		if config.EnhanceSeed != 0 {
+			seedElementSelection(config.EnhanceSeed)
+		}
+		batchChoices = upFrontChoices{}
+		resetDirImageCounts()
+	}
+
+	payload := newGenerateRequest(config)
+
+	// A seed sweep holds everything but the seed fixed, so style and cfg are chosen once up front
+	// Style keywords aren't API presets and are added to the prompt instead
+	if sweeping {
+		payload.CfgScale = config.CfgScale
+		if !continuingBatch {
+			batchChoices.stylePreset, batchChoices.styleKeyword = routeStyle(elements, config.pickStyle(elements, 0))
+		}
+		payload.StylePreset = batchChoices.stylePreset
+	}
+	styleKeyword := batchChoices.styleKeyword
+
+	// Pinned elements are chosen once so only the seed varies between images
+	pinned := config.FixElementsPerBatch && !sweeping
+	if pinned && !continuingBatch {
+		_, batchChoices.pinnedRandos, batchChoices.pinnedDirty = enhancePrompt(config.Prompt, config, elements, 0, config.NumImages)
+		updatePromptLog([]string{"\nElements pinned for this batch: ", joinPromptParts(batchChoices.pinnedDirty, batchChoices.pinnedRandos), "\n"})
+	}
+	pinnedRandos, pinnedDirty := batchChoices.pinnedRandos, batchChoices.pinnedDirty
+
+	// Continue the selection sequence of the interrupted run. Anything chosen up front
+	// above came from the fresh seed in both runs, so it is the same already.
+	if resumeState != nil {
+		applyResumeState(resumeState)
+		resumeState = nil
+	}
+
+	var lastCallTime time.Time
+	lastPause := batchStart
+	attempts := make(map[int]int)
+
+	for i := batchStart; i < config.NumImages; i++ {
+		if config.shouldStop() {
+			// Dump any logged info in the current buffer and break
+			flushPromptLog()
+			break
+		}
+
+		// An image that keeps failing (e.g. always all black for this prompt) is given up on
+		// instead of being retried forever
+		attempts[i]++
+		if attempts[i] > config.maxIndexAttempts() {
+			displayError("Image %d failed %d times - giving up on it", i+1, attempts[i]-1)
+			updatePromptLog([]string{fmt.Sprintf("\nImage %d permanently failed after %d attempts", i+1, attempts[i]-1)})
+			stats.RecordAbandoned()
+			continue
+		}
+
+		// A longer pause every BatchPauseEvery images to spread a big run out
+		if config.BatchPauseEvery > 0 && config.BatchPauseSec > 0 && i-lastPause >= config.BatchPauseEvery {
+			batchPause(config, i)
+			lastPause = i
+			if config.shouldStop() {
+				flushPromptLog()
+				break
+			}
+		}
+
+		// Saved before any choices for image i, so -resume makes the same ones
+		saveRunState(config, i)
+
+		payload.Seed = randSource.ImageSeed(i)
+		if sweeping {
+			payload.Seed = *seedSweep + int64(i)
+		}
+
+		// Derive the element picks from the image seed so the seed alone reproduces them
+		if config.SeedElementsFromImage {
+			seedElementSelection(payload.Seed)
+		}
+
+		// A seed sweep keeps the style chosen before the loop
+		if !sweeping {
+			payload.StylePreset, styleKeyword = routeStyle(elements, config.pickStyle(elements, i))
+		}
+
+		if i > 0 {
+			elapsed := time.Since(lastCallTime)
+			if sleepDuration := RATE_LIMIT - elapsed; sleepDuration > 0 {
+				profileSleep(PhaseRateLimit, i, sleepDuration)
+			}
+
+			if newPromptData, err := os.ReadFile(configPath); err == nil && configPath != "" && !sweeping {
+				newConfig, err := parseConfig(newPromptData, configPath)
+				if err != nil {
+					displayError("Error parsing updated config: %v", err)
+					continue
+				}
+				// Re-apply output directory params (determined during initialization) to newConfig
+				newConfig.OutputDir = config.OutputDir
+				newConfig.NameAsSubDir = config.NameAsSubDir
+				applyFlagOverrides(newConfig)
+				newConfig.setDisplaySettings() // Set display settings after loading config
+
+				payload.CfgScale = newConfig.CfgScale
+				payload.NegativePrompt = newConfig.negativePrompt(newConfig.Model)
+				payload.Model = newConfig.Model
+				config = newConfig
+				activeConfig = config
+			}
+
+			lastCallTime = time.Now()
+		}
+
+		fullPrompt, randomElements, dirtyElements := config.Prompt, "", ""
+		if pinned {
+			randomElements, dirtyElements = pinnedRandos, pinnedDirty
+			fullPrompt = joinPromptParts(config.Prompt, dirtyElements, randomElements)
+		} else if !sweeping {
+			fullPrompt, randomElements, dirtyElements = enhancePrompt(config.Prompt, config, elements, i, config.NumImages)
+		}
+		payload.Prompt = dedupPrompt(joinPromptParts(fullPrompt, styleKeyword))
+		if len(payload.Prompt) > MaxPromptLength {
+			displayError("Prompt too complex, consider simplifying")
+			continue
+		}
+
+		if payload.CfgScale == 0 || config.FixedCfg {
+			payload.CfgScale = config.nextCfgScale()
+		}
+
+		payload.Model = config.currentModel()
+		payload.NegativePrompt = config.negativePrompt(payload.Model)
+
+		if fullScreen() {
+			fmt.Print("\033[H")
+		}
+		updateProgress(i, config.NumImages,
+			joinPromptParts(payload.StylePreset, styleKeyword),
+			joinPromptParts(dirtyElements, randomElements),
+			"Generating...",
+			payload.Model,
+			payload.CfgScale)
+
+		// Only ask for as many images as are still needed
+		payload.Variants = 0
+		if config.ImagesPerRequest > 1 && !payload.ReturnBinary && !config.AblateNegative {
+			payload.Variants = min(config.ImagesPerRequest, config.NumImages-i)
+		}
+
+		// Don't pay for an image whose file is already there (only seed sweeps and labelled
+		// images have names that can repeat)
+		if config.collisionStrategy() == CollisionSkip && !*toStdout && !config.AblateNegative &&
+			imageFilename(config, &payload, i) == "" {
+			continue
+		}
+
+		if config.AblateNegative {
+			i = requestAblationPair(i, &payload, config)
+		} else {
+			i = requestImage(i, &payload, config)
+		}
+	}
+}
+
+// requestAblationPair generates image index i twice at the same seed, once with the
+// negative prompt (_neg) and once without (_noneg), so its effect can be compared directly
+func requestAblationPair(i int, payload *GenerateRequest, config *PromptConfig) int {
+	negative := payload.NegativePrompt
+	defer func() {
+		payload.NegativePrompt = negative
+		payload.FileSuffix = ""
+	}()
+
+	// The returned index alone doesn't tell whether _neg was stored (some failures leave it
+	// as it was), and a _noneg without its _neg is nothing to compare with
+	payload.FileSuffix = "_neg"
+	before := stats.Stored()
+	if next := requestImage(i, payload, config); next != i || stats.Stored() == before {
+		return next
+	}
+
+	payload.NegativePrompt = ""
+	payload.FileSuffix = "_noneg"
+	return requestImage(i, payload, config)
+}
+
+// newGenerateRequest builds the request payload from the config; the prompt, style and
+// seed are filled in per image
+func newGenerateRequest(config *PromptConfig) GenerateRequest {
+	return GenerateRequest{
+		Model:          config.Model,
+		Prompt:         config.Prompt,
+		Width:          config.Width,
+		Height:         config.Height,
+		Steps:          config.Steps,
+		HideWatermark:  true,
+		ReturnBinary:   config.ReturnBinary,
+		SafeMode:       false,
+		CfgScale:       config.nextCfgScale(),
+		NegativePrompt: config.negativePrompt(config.Model),
+	}
+}
 
-	var filename string
-	var fullFilePath string
+// marshalRequest encodes the payload and adds the extra fields it doesn't already contain
+func marshalRequest(payload *GenerateRequest, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
 
-	for {
-		filename = fmt.Sprintf("%s-%s_seed%d_scale%.1f.png",
-			nameClean,
-			iteration,
-			seed,
-			cfgScale,
-		)
-		fullFilePath = filepath.Join(outputDir, filename)
-		if _, err := os.Stat(fullFilePath); os.IsNotExist(err) {
-			break // File doesn't exist, we can use this name
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	for key, value := range extra {
+		if _, ok := fields[key]; !ok {
+			fields[key] = value
 		}
-		counter++
-		iteration = fmt.Sprintf("%d.%d", imgNum, counter)
 	}
+	return json.Marshal(fields)
+}
 
-	enhancedParts := strings.TrimPrefix(fullPrompt, basePrompt)
-	enhancedParts = strings.TrimPrefix(enhancedParts, ", ")
-	var logLines []string
-	logLines = append(logLines, "\n=====> File: ", filename)
-	if stylePreset != "" {
-		logLines = append(logLines, "\nImage Style: ", stylePreset)
+// requestImage sends the payload for image index i and stores the result, returning the
+// (possibly adjusted) index just like handleResponse
+func requestImage(i int, payload *GenerateRequest, config *PromptConfig) int {
+	payload.RequestID = newRequestID()
+	if note := clampToModel(payload); note != "" && !clampWarned[note] {
+		clampWarned[note] = true
+		displayError("Warning: %s, using the nearest accepted value", note)
 	}
-	if enhancedParts != "" {
-		logLines = append(logLines, "\nElements:    ", enhancedParts, "\n")
+	jsonData, err := marshalRequest(payload, config.Extra)
+	if err != nil {
+		displayError("Error creating request: %v", err)
+		return i
 	}
-	if err := updatePromptLog(logLines); err != nil {
-		return ""
+
+	req, err := http.NewRequestWithContext(runCtx, "POST", API_URL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		displayError("Error creating HTTP request: %v", err)
+		return i
 	}
 
-	return fullFilePath
-}
+	addAPIHeaders(req, config, payload.RequestID)
+	setAPIKey(req)
+	req.Header.Add("Content-Type", "application/json")
 
-func debugLog(format string, args ...interface{}) {
-	// Move to line right after progress display
-	fmt.Printf("\033[%d;0H", PROGRESS_LINES+1)
-	// Clear from cursor to end of line
-	fmt.Print("\033[K")
-	// Print debug message with timestamp
-	fmt.Printf("[%s] %s\n", time.Now().Format("15:04:05"), fmt.Sprintf(format, args...))
-	// Return cursor to top for next progress update
-	fmt.Print("\033[H")
+	client := newAPIClient(config, config.requestTimeout())
+	return handleResponse(i, payload, config, client, req)
 }
 
-var interrupted bool
-
-func handleResponse(i int, payload *GenerateRequest, config *PromptConfig, client *http.Client, req *http.Request) int {
-	maxRetries := 3
-	retryDelay := 5 * time.Second
-
-	for retry := 0; retry < maxRetries; retry++ {
-		if retry > 0 {
-			displayError("Retrying request (attempt %d/%d)...", retry+1, maxRetries)
-			time.Sleep(retryDelay)
-		}
+func main() {
+	flag.Parse()
+	expandPathFlags()
+
+	switch flag.Arg(0) {
+	case "elements":
+		os.Exit(runElementsCommand(flag.Args()[1:]))
+	case "audit":
+		os.Exit(runAuditCommand(flag.Args()[1:]))
+	case "diff":
+		os.Exit(runDiffCommand(flag.Args()[1:]))
+	case "gallery":
+		os.Exit(runGalleryCommand(flag.Args()[1:]))
+	}
 
-		debugLog("Starting API request...")
+	if *validateOnly {
+		os.Exit(validateConfig(promptConfigPath()))
+	}
 
-		resp, err := client.Do(req)
-		if err != nil {
-			displayError("HTTP request failed: %v", err)
-			debugLog("Request failed")
-			failedCount++
-			time.Sleep(10 * time.Second)
-			continue
-		}
-		defer resp.Body.Close()
+	if *cleanDir != "" {
+		os.Exit(cleanOutputDir(*cleanDir))
+	}
 
-		debugLog("Got response, reading body...")
+	if *storeKey {
+		os.Exit(storeAPIKey(promptConfigPath()))
+	}
 
-		body, err := io.ReadAll(resp.Body)
-		if err != nil {
-			displayError("Error reading response: %v", err)
-			debugLog("Failed to read body")
-			failedCount++
-			time.Sleep(10 * time.Second)
-			continue
-		}
+	if *showModels {
+		listModels()
+		return
+	}
 
-		debugLog("Read body: %d bytes", len(body))
+	if err := checkCategoryFlags(); err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -enable/-disable: %v\n", err)
+		os.Exit(2)
+	}
 
-		if resp.StatusCode != 200 {
-			var apiError struct {
-				Error   string      `json:"error"`
-				Message string      `json:"message"`
-				Details interface{} `json:"details"`
-			}
-			if err := json.Unmarshal(body, &apiError); err == nil {
-				if apiError.Error != "" {
-					displayError("API Error: %s", apiError.Error)
-				}
-				if apiError.Message != "" {
-					displayError("API Message: %s", apiError.Message)
-				}
-				if apiError.Details != nil {
-					displayError("API Details: %v", apiError.Details)
-				}
-			} else {
-				displayError("API Error (Status %d): %s", resp.StatusCode, string(body))
-			}
+	if *testRun && (*toStdout || *queueFile != "" || *watchConfig) {
+		fmt.Fprintln(os.Stderr, "-test can't be combined with -stdout, -watch or -watch-config")
+		os.Exit(2)
+	}
 
-			failedCount++
-			switch resp.StatusCode {
-			case 401:
-				displayError("Authentication failed - check your API key")
-				return i
-			case 429:
-				displayError("Rate limit exceeded - waiting longer before retry")
-				time.Sleep(RATE_LIMIT * 2)
-				i-- // Retry this iteration
-			case 500, 502, 503, 504:
-				displayError("Server error - will retry")
-				time.Sleep(5 * time.Second)
-				i-- // Retry this iteration
-			default:
-				displayError("Unexpected error occurred")
-			}
-			time.Sleep(10 * time.Second)
-			continue
-		}
+	if *resumeRun && (*toStdout || *queueFile != "" || *watchConfig || *testRun || *fromImage != "" ||
+		*seedSweep >= 0 || *listPresets || *sampleCategory != "") {
+		fmt.Fprintln(os.Stderr, "-resume only continues a plain run and can't be combined with -stdout, -watch, -watch-config, -test, -from, -seed-sweep, -list-presets or -sample")
+		os.Exit(2)
+	}
 
-		var result GenerateResponse
-		if err := json.Unmarshal(body, &result); err != nil {
-			displayError("Error parsing API response: %v", err)
-			debugLog("Failed to parse API response")
-			continue
-		}
-		debugLog("Successfully parsed API response, processing %d images", len(result.Images))
+	if *watchConfig && (*stdinConfig || *configFile == "-") {
+		fmt.Fprintln(os.Stderr, "-watch-config needs a config file to watch, not -stdin")
+		os.Exit(2)
+	}
+	if *profileRun && (*queueFile != "" || *watchConfig) {
+		fmt.Fprintln(os.Stderr, "-profile can't be combined with -watch or -watch-config")
+		os.Exit(2)
+	}
 
-		// Make sure we capture any changes made to the iteration int during attempt to store the image...
-		i = storeImageResult(i, result, payload, config)
-		if lastError != "" {
-			debugLog("Stopped due to error writing the image to disk.")
-			continue
-		}
+	if *interactive && (*toStdout || *queueFile != "" || *watchConfig || *resumeRun || *testRun || *archiveFile != "" ||
+		*fromImage != "" || *seedSweep >= 0 || *profileRun) {
+		fmt.Fprintln(os.Stderr, "-interactive can't be combined with -stdout, -watch, -watch-config, -resume, -test, -archive, -from, -seed-sweep or -profile")
+		os.Exit(2)
+	}
 
-		debugLog("Completed processing this generation")
+	if *archiveFile != "" && (*toStdout || *queueFile != "" || *watchConfig || *resumeRun) {
+		fmt.Fprintln(os.Stderr, "-archive can't be combined with -stdout, -watch, -watch-config or -resume")
+		os.Exit(2)
+	}
+	if *archiveFile != "" && archiveFormat(*archiveFile) == "" {
+		fmt.Fprintln(os.Stderr, "-archive must name a .zip, .tar.gz or .tgz file")
+		os.Exit(2)
+	}
 
-		break // Success, exit retry loop
+	if *deterministic >= 0 {
+		randSource = newDeterministicSource(*deterministic)
 	}
 
-	return i
-}
+	if *fromClipboard && *fromImage != "" {
+		fmt.Fprintln(os.Stderr, "-clipboard and -from can't be used together")
+		os.Exit(2)
+	}
 
-func storeImageResult(i int, result GenerateResponse, payload *GenerateRequest, config *PromptConfig) int {
-	for _, imgData := range result.Images {
-		debugLog("Decoding image data...")
-		imgBytes, err := base64.StdEncoding.DecodeString(imgData)
-		if err != nil {
-			displayError("Error decoding image data: %v", err)
-			debugLog("Failed to decode image data")
-			continue
+	if *fromClipboard {
+		prompt, err := readClipboard()
+		if len(prompt) > MaxPromptLength {
+			fmt.Fprintf(os.Stderr, "Clipboard prompt is %d characters, the maximum is %d\n", len(prompt), MaxPromptLength)
+			os.Exit(2)
 		}
-		debugLog("Successfully decoded image (%d bytes)", len(imgBytes))
-
-		isAllBlack := true
-		for _, b := range imgBytes {
-			if b != 0 {
-				isAllBlack = false
-				break
-			}
+		switch {
+		case err != nil:
+			promptSource = fmt.Sprintf("prompt.json (clipboard unavailable: %v)", err)
+		case prompt == "":
+			promptSource = "prompt.json (clipboard empty)"
+		default:
+			promptSource = "clipboard"
 		}
-
-		minImageSize := 100_000
-		if isAllBlack {
-			displayError("Generated image was all black, retrying...")
-			debugLog("Image was all black")
-			i--
-			continue
+		if prompt == "" {
+			fmt.Fprintf(os.Stderr, "Using the prompt from %s\n", promptSource)
 		}
+		clipboardPrompt = prompt
+	}
 
-		if len(imgBytes) < minImageSize {
-			failedCount++
-			contentType := http.DetectContentType(imgBytes)
-			debugLog("Image too small or wrong format: %s, size: %d", contentType, len(imgBytes))
-			if contentType != "image/png" {
-				displayError("Unexpected file format: %s (expected PNG)", contentType)
-			}
-			i--
-			continue
+	flag.Visit(func(f *flag.Flag) {
+		if (f.Name == "n" || f.Name == "count") && *imageCount <= 0 {
+			fmt.Fprintf(os.Stderr, "-%s must be a positive number of images\n", f.Name)
+			os.Exit(2)
 		}
-
-		filename := generateFilenameAndLogDetail(config, payload, i)
-		debugLog("Attempting to save image...")
-		debugLog("File size: %d bytes", len(imgBytes))
-
-		if err := os.WriteFile(filename, imgBytes, 0644); err != nil {
-			displayError("Error saving image: %v", err)
-			debugLog("Failed to save image: %v", err)
-			continue
+		// The model isn't known yet, so these are the widest bounds; checkModelLimits narrows them
+		if f.Name == "cfg" && (*cfgOverride < defaultLimits.MinCfg || *cfgOverride > defaultLimits.MaxCfg) {
+			fmt.Fprintf(os.Stderr, "-cfg must be within %g-%g\n", defaultLimits.MinCfg, defaultLimits.MaxCfg)
+			os.Exit(2)
+		}
+		if f.Name == "steps" && (*stepsOverride < defaultLimits.MinSteps || *stepsOverride > defaultLimits.MaxSteps) {
+			fmt.Fprintf(os.Stderr, "-steps must be between %d and %d\n", defaultLimits.MinSteps, defaultLimits.MaxSteps)
+			os.Exit(2)
 		}
+	})
 
-		debugLog("Image Saved Successfully")
-		lastError = "" // Clear error status on success
+	if *dimsFlag != "" {
+		width, height, note, err := parseDims(*dimsFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -dims: %v\n", err)
+			os.Exit(2)
+		}
+		if note != "" {
+			fmt.Fprintf(os.Stderr, "Warning: %s\n", note)
+		}
+		dimsWidth, dimsHeight = width, height
 	}
 
-	return i
-}
+	if *quiet {
+		quietMode = true
+	}
 
-func main() {
+	if *toStdout {
+		quietMode = true
+		// Errors have already been reported on stderr, just make sure the exit status reflects them
+		defer func() {
+			if stats.Stored() == 0 {
+				os.Exit(1)
+			}
+		}()
+	}
 
-	config, err := initializeVeniceConfig()
+	var config *PromptConfig
+	var err error
+	switch {
+	case *stdinConfig || *configFile == "-":
+		config, err = readStdinConfig()
+	case *configFile != "":
+		config, err = readConfigFile(*configFile)
+	default:
+		config, err = initializeVeniceConfig()
+	}
+	if err != nil && (*stdinConfig || *configFile != "") {
+		// There may be no usable config for the progress display, so report it plainly
+		fmt.Fprintf(os.Stderr, "Initialization failed: %v\n", err)
+		os.Exit(1)
+	}
 	if err != nil {
 		displayError("Initialization failed: %v", err)
 		return
 	}
+	if *outputFlag != "" {
+		config.OutputDir = *outputFlag
+	}
+	activeConfig = config
+
+	if *fromImage != "" {
+		recipe, err := loadImageRecipe(*fromImage, config.promptLogName())
+		if err != nil {
+			displayError("Error reading %s: %v", *fromImage, err)
+			return
+		}
+		applyRecipe(config, recipe)
+		promptSource = fmt.Sprintf("%s (from %s)", *fromImage, strings.Join(recipe.Sources, ", "))
+	}
+
+	if *exportFile != "" {
+		if limits := limitsFor(config.Model); config.CfgScale < limits.MinCfg || config.CfgScale > limits.MaxCfg {
+			config.CfgScale = 8.5
+		}
+		applyFlagOverrides(config)
+		elements, err := loadPromptElements()
+		if err != nil {
+			displayError("Warning: %v - using just the base prompt", err)
+		}
+		if err := exportPrompts(*exportFile, config, elements); err != nil {
+			displayError("Export failed: %v", err)
+			return
+		}
+		fmt.Printf("Wrote %d prompts to %s\n", config.NumImages, *exportFile)
+		return
+	}
 
 	// Set up signal handling at the beginning of main
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt, syscall.SIGTERM)
-	go func() {
-		<-sigChan
-		interrupted = true
-		// Clear any pending ANSI commands, flush buffered output, and restore terminal
-		fmt.Print("\033[?25h\033[0m") // Show cursor, reset colors
-		os.Stdout.Sync()              // Flush any buffered output
-		os.Exit(1)
-	}()
+	go handleInterrupt(sigChan)
 
-	configPath := filepath.Join(os.Getenv("HOME"), ".venice", "prompt.json")
+	// A config read from stdin can't change during the run
+	configPath := promptConfigPath()
 
 	currentUser, err := user.Current()
 	if err != nil {
 		displayError("Error getting current user: %v", err)
 		return
 	}
+	setStopFile(currentUser)
 
-	if err := checkAPIStatus(config.APIKey); err != nil {
+	setupAPIKeys(config)
+	if err := checkAPIStatus(config); err != nil {
 		displayError("API Status Check Failed: %v", err)
 		return
 	}
 
-	outputDir, useSubDir, err := getOutputDirectory(config, currentUser)
+	models, err := getAvailableModels(config, *refreshModels)
 	if err != nil {
-		displayError("Error creating output directory: %v", err)
+		displayError("Error fetching models: %v", err)
+		return
+	}
+	if err := validateModel(config.Model, models); err != nil {
+		displayError("Invalid model: %v", err)
 		return
 	}
 
-	// With all paths and configs set, let's intialize a new TXT file to log the prompts used for each image
-	config.OutputDir = outputDir
-	if err := initPromptLog(config); err != nil {
-		displayError("Error initializing Prompt Log!")
+	if *interactive {
+		applyFlagOverrides(config)
+		runInteractive(config, currentUser)
+		exitIfAuthFailed()
+		return
+	}
+	if err := setupUploads(config); err != nil {
+		displayError("Error setting up uploads: %v", err)
 		return
 	}
 
-	if config.CfgScale < 1 || config.CfgScale > 20 {
-		config.CfgScale = 8.5
+	if *queueFile != "" {
+		elements, err := loadPromptElements()
+		if err != nil {
+			displayError("Warning: %v - using just the base prompt", err)
+		}
+		if err := watchQueue(*queueFile, config, elements, currentUser); err != nil {
+			displayError("Queue failed: %v", err)
+		}
+		exitIfAuthFailed()
+		return
 	}
 
-	elements, err := loadPromptElements()
-	if err != nil {
-		displayError("Error loading Elements: %v", err)
+	if *skipIfRecent > 0 {
+		if baseDir, err := baseOutputDirectory(config, currentUser); err == nil {
+			if recent, age := recentImage(config, baseDir, *skipIfRecent); recent != "" {
+				fmt.Printf("Skipping run: %s was generated %s ago (within -skip-if-recent %s)\n",
+					recent, age.Round(time.Second), *skipIfRecent)
+				return
+			}
+		}
 	}
 
-	fmt.Print("\033[H\033[2J")
-	fmt.Println()
-	fmt.Println()
+	var outputDir string
+	var useSubDir bool
+	if *resumeRun {
+		state, err := loadRunState(currentUser, config)
+		if err != nil {
+			displayError("Can't resume: %v", err)
+			return
+		}
+		// Same folder and image numbers, adding to the interrupted run's log
+		outputDir, useSubDir = state.OutputDir, state.NameAsSubDir
+		config.NumImages = state.NumImages
+		config.AppendPromptLog = true
+		batchStart = state.NextImage
+		resumeState = state
+		promptSource = fmt.Sprintf("resumed at image %d of %d", state.NextImage+1, state.NumImages)
+		if state.EnhanceSeed == 0 {
+			displayError("Warning: the run has no enhance_seed, so the remaining images get new random elements")
+		}
+	} else {
+		outputDir, useSubDir, err = getOutputDirectory(config, currentUser)
+		if err != nil {
+			displayError("Error creating output directory: %v", err)
+			return
+		}
+	}
+	runOutputDir = outputDir
 
-	payload := GenerateRequest{
-		Model:          config.Model,
-		Prompt:         config.Prompt,
-		Width:          config.Width,
-		Height:         config.Height,
-		Steps:          config.Steps,
-		HideWatermark:  true,
-		ReturnBinary:   false,
-		SafeMode:       false,
-		CfgScale:       generateCfgScale(config.MinConfig, config.MaxConfig),
-		NegativePrompt: config.NegativePrompt,
+	if limits := limitsFor(config.Model); config.CfgScale < limits.MinCfg || config.CfgScale > limits.MaxCfg {
+		config.CfgScale = 8.5
 	}
 
-	var lastCallTime time.Time
+	// Overrides go first so the log header shows what the run actually uses
+	applyFlagOverrides(config)
+	if err := checkNativeDimensions(config); err != nil {
+		displayError("Warning: %v", err)
+	}
+	if err := checkModelLimits(config); err != nil {
+		displayError("Warning: %v, the nearest accepted value will be used", err)
+		limits := limitsFor(config.Model)
+		config.Steps = min(max(config.Steps, limits.MinSteps), limits.MaxSteps)
+	}
+	if resumeState != nil && resumeState.Prompt != config.Prompt {
+		displayError("Can't resume: the prompt has changed since the run was interrupted")
+		return
+	}
 
-	for i := 0; i < config.NumImages; i++ {
-		if interrupted || failedCount >= 3 {
-			// Dump any logged info in the current buffer and break
-			wrLog.Flush()
-			break
+	// With all paths and configs set, let's intialize a new TXT file to log the prompts used for each image
+	config.OutputDir = outputDir
+	config.NameAsSubDir = useSubDir
+	if err := initPromptLog(config); err != nil {
+		displayError("Error initializing Prompt Log!")
+		return
+	}
+	if *archiveFile != "" {
+		if err := setupArchive(*archiveFile, config); err != nil {
+			displayError("%v", err)
+			closePromptLog()
+			return
 		}
+		// Runs after the prompt log is closed so the archive gets all of it
+		defer finishArchive()
+	}
+	defer closePromptLog()
+	if promptSource != "" {
+		updatePromptLog([]string{"\nPrompt Source: ", promptSource, "\n"})
+	}
 
-		if config.Style && len(elements.Style) > 0 {
-			style := getRandomItem(elements.Style)
-			payload.StylePreset = style
-		} else {
-			// Ensure StylePreset is empty when style is false
-			payload.StylePreset = ""
+	sweeping := *seedSweep >= 0
+	if sweeping {
+		if *sweepCount <= 0 {
+			displayError("Seed sweep count must be positive")
+			return
 		}
+		config.NumImages = *sweepCount
+	}
 
-		if i > 0 {
-			elapsed := time.Since(lastCallTime)
-			if sleepDuration := RATE_LIMIT - elapsed; sleepDuration > 0 {
-				time.Sleep(sleepDuration)
-			}
-
-			if newPromptData, err := os.ReadFile(configPath); err == nil {
-				var newConfig PromptConfig
-				if err := json.Unmarshal(newPromptData, &newConfig); err != nil {
-					displayError("Error parsing updated config: %v", err)
-					continue
-				}
-				// Re-apply output directory params (determined during initialization) to newConfig
-				newConfig.OutputDir = outputDir
-				newConfig.NameAsSubDir = useSubDir
-				newConfig.setDisplaySettings() // Set display settings after loading config
+	if *watchConfig {
+		watchConfigFiles(config, configPath, currentUser)
+		return
+	}
 
-				payload.CfgScale = newConfig.CfgScale
-				payload.NegativePrompt = newConfig.NegativePrompt
-				payload.Model = newConfig.Model
-				config = &newConfig
-			}
+	elements, err := loadPromptElements()
+	if err != nil {
+		displayError("Warning: %v - using just the base prompt", err)
+	}
 
-			lastCallTime = time.Now()
-		}
+	if fullScreen() {
+		fmt.Print("\033[H\033[2J")
+		fmt.Println()
+		fmt.Println()
+	}
 
-		fullPrompt, randomElements, dirtyElements := enhancePrompt(config.Prompt, config, elements)
-		payload.Prompt = fullPrompt
-		if len(payload.Prompt) > MaxPromptLength {
-			displayError("Prompt too complex, consider simplifying")
-			continue
-		}
+	runStarted = time.Now()
+	if *profileRun {
+		startProfile()
+	}
 
-		payload.Seed = time.Now().UnixNano()%99_999_999 + int64(i)
-		if payload.CfgScale == 0 {
-			payload.CfgScale = generateCfgScale(config.MinConfig, config.MaxConfig)
+	if *listPresets {
+		generatePresetSheet(config, elements)
+	} else if *sampleCategory != "" {
+		generateCategorySamples(config, elements, *sampleCategory)
+	} else {
+		// Only a plain run can be resumed
+		if !sweeping && *fromImage == "" && !*toStdout {
+			trackRunState(currentUser)
 		}
-
-		fmt.Print("\033[H")
-		updateProgress(i, config.NumImages,
-			payload.StylePreset,
-			randomElements+", "+dirtyElements,
-			"Generating...",
-			payload.Model,
-			payload.CfgScale)
-
-		jsonData, err := json.Marshal(payload)
-		if err != nil {
-			displayError("Error creating request: %v", err)
-			continue
+		if *testRun {
+			generateWithTest(config, elements, configPath)
+		} else {
+			generateBatch(config, elements, configPath)
 		}
-
-		req, err := http.NewRequest("POST", API_URL, bytes.NewBuffer(jsonData))
-		if err != nil {
-			displayError("Error creating HTTP request: %v", err)
-			continue
+		if !config.shouldStop() {
+			clearRunState()
 		}
+	}
 
-		req.Header.Add("Authorization", "Bearer "+config.APIKey)
-		req.Header.Add("Content-Type", "application/json")
+	doneMessage := "✨ Generation complete!"
+	if interrupted {
+		notifyWebhook(activeConfig, "interrupted", "⏹️ Venice run interrupted: "+config.PromptName)
+	} else if abortReason != "" {
+		doneMessage = "🛑 Run stopped: " + abortReason
+		notifyWebhook(activeConfig, "aborted", "🛑 Venice run stopped ("+abortReason+"): "+config.PromptName)
+	} else {
+		notifyWebhook(activeConfig, "complete", "✨ Venice run complete: "+config.PromptName)
+	}
 
-		client := &http.Client{Timeout: 60 * time.Second}
-		i = handleResponse(i, &payload, config, client, req)
+	if !interrupted && *barMode && !quietMode {
+		flushPromptLog()
+		fmt.Println()
+		fmt.Println(doneMessage)
 	}
 
-	if !interrupted {
+	if !interrupted && fullScreen() {
 		// Flush the write buffer to make sure we store any unwritten logged data to our log file.
-		wrLog.Flush()
+		flushPromptLog()
 		// Only clear the screen if not interrupted
-		fmt.Print("\033[H\033[2J")
-		fmt.Println()
-		fmt.Println()
-		fmt.Println("✨ Generation complete!")
+		leaveProgressDisplay(activeConfig)
+		fmt.Println(doneMessage)
 		fmt.Println()
 	}
+
+	if *profileRun {
+		// Keep stdout for the image with -stdout
+		out := os.Stdout
+		if *toStdout {
+			out = os.Stderr
+		}
+		printProfile(out)
+	}
+
+	if *jsonSummary {
+		printRunSummary(activeConfig)
+	}
+	exitIfAuthFailed()
+}
+
+// exitIfAuthFailed ends the process with a non-zero status after the API rejected the key,
+// flushing the prompt log first since deferred calls don't run on os.Exit
+func exitIfAuthFailed() {
+	if abortReason != AbortAuth {
+		return
+	}
+	closePromptLog()
+	finishArchive()
+	os.Exit(1)
 }
 
 func createDefaultElementsFile(elementsPath string) error {
@@ -1110,13 +2982,16 @@ func createDefaultElementsFile(elementsPath string) error {
     	    "Line Art", "Neon Punk", "Origami", "Photographic", "Pixel Art",
     	    "Texture", "Abstract", "Cubist", "Graffiti", "Hyperrealism",
     	    "Impressionist", "Renaissance", "Steampunk", "Surrealist", "Typography",
-    	    "Watercolor", "Fighting Game", "Super Mario", "Minecraft", "Pokemon",
-    	    "Retro Arcade", "Retro Game", "RPG Fantasy Game", "Strategy Game",
-    	    "Street Fighter", "Legend of Zelda", "Dreamscape", "Dystopian",
+    	    "Watercolor", "Fighting Game", "Retro Arcade", "Retro Game",
+    	    "RPG Fantasy Game", "Strategy Game", "Dreamscape", "Dystopian",
     	    "Fairy Tale", "Gothic", "Grunge", "Horror", "Minimalist", "Monochrome",
     	    "Space", "Techwear Fashion", "Tribal", "Alien", "Film Noir", "HDR",
     	    "Long Exposure", "Neon Noir", "Silhouette", "Tilt-Shift"
     	],
+    	"style_keywords": [
+    	    "Super Mario style", "Minecraft style", "Pokemon style",
+    	    "Street Fighter style", "Legend of Zelda style"
+    	],
     	"face": [
     	    "butterfly face design", "scalp texture", "crystal motifs", "blue freckles",
     	    "golden lips", "frost finish", "rainbow designs", "glowing symbols",
@@ -1282,5 +3157,9 @@ func createDefaultElementsFile(elementsPath string) error {
     	],
     	"dirty": []
     }`
-	return os.WriteFile(elementsPath, []byte(defaultElements), 0644)
+	elementJSON, err := formatJSON([]byte(defaultElements))
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(elementsPath, elementJSON, 0644)
 }
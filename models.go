@@ -0,0 +1,326 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	MODELS_URL       = "https://api.venice.ai/api/v1/models?type=image"
+	DefaultModelsTTL = 24 * time.Hour
+)
+
+// modelDescriptions describes the MODEL_* constants for the -models listing
+var modelDescriptions = []struct {
+	id          string
+	description string
+}{
+	{MODEL_FLUENTLY_XL, "default, fastest"},
+	{MODEL_FLUX_DEV, "highest quality"},
+	{MODEL_FLUX_DEV_UNCENSORED, "flux-dev without content filtering"},
+	{MODEL_PONY_REALISM, "most uncensored"},
+	{MODEL_SDXL, "most gross ...probably"},
+	{MODEL_STABLE_DIFFUSION, "most creative"},
+}
+
+// nativeDimensions are the resolutions each model was trained at and gives its best
+// results with
+var nativeDimensions = map[string][2]int{
+	MODEL_FLUENTLY_XL:         {1024, 1024},
+	MODEL_FLUX_DEV:            {1024, 1024},
+	MODEL_FLUX_DEV_UNCENSORED: {1024, 1024},
+	MODEL_PONY_REALISM:        {1024, 1024},
+	MODEL_SDXL:                {1024, 1024},
+	MODEL_STABLE_DIFFUSION:    {1024, 1024},
+}
+
+// applyNativeDimensions sets Width/Height to the model's native resolution for -native
+func applyNativeDimensions(config *PromptConfig) {
+	if native, ok := nativeDimensions[config.Model]; ok {
+		config.Width, config.Height = native[0], native[1]
+	}
+}
+
+// checkNativeDimensions warns when the configured size is far from what the model was
+// trained at (less than half or more than twice the pixels)
+func checkNativeDimensions(config *PromptConfig) error {
+	native, ok := nativeDimensions[config.Model]
+	if !ok || config.Width <= 0 || config.Height <= 0 {
+		return nil
+	}
+	ratio := float64(config.Width*config.Height) / float64(native[0]*native[1])
+	if ratio < 0.5 || ratio > 2 {
+		return fmt.Errorf("%dx%d is far from %s's native %dx%d, results may suffer (try -native)",
+			config.Width, config.Height, config.Model, native[0], native[1])
+	}
+	return nil
+}
+
+// modelLimits are the steps and cfg scale a model accepts
+type modelLimits struct {
+	MinSteps int
+	MaxSteps int
+	MinCfg   float64
+	MaxCfg   float64
+}
+
+// defaultLimits apply to models missing from modelBounds and are the widest any model accepts
+var defaultLimits = modelLimits{MinSteps: 5, MaxSteps: 50, MinCfg: 1, MaxCfg: 20}
+
+// modelBounds holds the models whose accepted ranges differ from defaultLimits. The step
+// limits are the model_spec.constraints.steps.max that MODELS_URL reports for each model;
+// the API documents a cfg scale of 1-20 for every image model. Re-check them there when the
+// API starts rejecting requests these allow.
+var modelBounds = map[string]modelLimits{
+	MODEL_FLUX_DEV:            {MinSteps: 5, MaxSteps: 30, MinCfg: 1, MaxCfg: 20},
+	MODEL_FLUX_DEV_UNCENSORED: {MinSteps: 5, MaxSteps: 30, MinCfg: 1, MaxCfg: 20},
+	MODEL_STABLE_DIFFUSION:    {MinSteps: 5, MaxSteps: 30, MinCfg: 1, MaxCfg: 20},
+}
+
+func limitsFor(model string) modelLimits {
+	if limits, ok := modelBounds[model]; ok {
+		return limits
+	}
+	return defaultLimits
+}
+
+// checkModelLimits reports a steps or cfg setting the model would reject
+func checkModelLimits(config *PromptConfig) error {
+	limits := limitsFor(config.Model)
+	if config.Steps < limits.MinSteps || config.Steps > limits.MaxSteps {
+		return fmt.Errorf("%s accepts %d-%d steps (got %d)",
+			config.Model, limits.MinSteps, limits.MaxSteps, config.Steps)
+	}
+	if config.CfgScale != 0 && (config.CfgScale < limits.MinCfg || config.CfgScale > limits.MaxCfg) {
+		return fmt.Errorf("%s accepts a cfg scale of %g-%g (got %g)",
+			config.Model, limits.MinCfg, limits.MaxCfg, config.CfgScale)
+	}
+	if !config.FixedCfg && (config.MinConfig < limits.MinCfg || config.MaxConfig > limits.MaxCfg) {
+		return fmt.Errorf("%s accepts a cfg scale of %g-%g (min_config/max_config are %g-%g)",
+			config.Model, limits.MinCfg, limits.MaxCfg, config.MinConfig, config.MaxConfig)
+	}
+	return nil
+}
+
+// clampToModel brings the request's steps and cfg scale within what its model accepts,
+// describing what was changed
+func clampToModel(payload *GenerateRequest) string {
+	limits := limitsFor(payload.Model)
+	var changed []string
+	if steps := min(max(payload.Steps, limits.MinSteps), limits.MaxSteps); steps != payload.Steps {
+		changed = append(changed, fmt.Sprintf("steps %d -> %d", payload.Steps, steps))
+		payload.Steps = steps
+	}
+	if cfg := min(max(payload.CfgScale, limits.MinCfg), limits.MaxCfg); cfg != payload.CfgScale {
+		changed = append(changed, fmt.Sprintf("cfg scale %g -> %g", payload.CfgScale, cfg))
+		payload.CfgScale = cfg
+	}
+	if len(changed) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s is out of range for %s", strings.Join(changed, ", "), payload.Model)
+}
+
+// clampWarned remembers the clamps already reported so each is shown once per run
+var clampWarned = make(map[string]bool)
+
+// ModelsCache is the on-disk copy of the model list stored in ~/.venice/models_cache.json
+type ModelsCache struct {
+	FetchedAt time.Time `json:"fetched_at"`
+	Models    []string  `json:"models"`
+}
+
+func modelsCachePath() (string, error) {
+	currentUser, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("error getting current user: %v", err)
+	}
+	return filepath.Join(currentUser.HomeDir, ".venice", "models_cache.json"), nil
+}
+
+// modelsCacheTTL returns the configured cache lifetime, falling back to 24h
+func modelsCacheTTL(config *PromptConfig) time.Duration {
+	if config.ModelsCacheTTL == "" {
+		return DefaultModelsTTL
+	}
+	ttl, err := time.ParseDuration(config.ModelsCacheTTL)
+	if err != nil || ttl <= 0 {
+		return DefaultModelsTTL
+	}
+	return ttl
+}
+
+func loadModelsCache() (*ModelsCache, error) {
+	cachePath, err := modelsCachePath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var cache ModelsCache
+	if err := json.Unmarshal(data, &cache); err != nil {
+		return nil, fmt.Errorf("error parsing models cache: %v", err)
+	}
+	return &cache, nil
+}
+
+func saveModelsCache(cache *ModelsCache) error {
+	cachePath, err := modelsCachePath()
+	if err != nil {
+		return err
+	}
+
+	cacheJSON, err := marshalJSON(cache)
+	if err != nil {
+		return fmt.Errorf("error creating models cache: %v", err)
+	}
+
+	// Write to a temp file first so a concurrent reader never sees a partial cache
+	tmpPath := cachePath + ".tmp"
+	if err := os.WriteFile(tmpPath, cacheJSON, 0644); err != nil {
+		return fmt.Errorf("error writing models cache: %v", err)
+	}
+	return os.Rename(tmpPath, cachePath)
+}
+
+func fetchModels(config *PromptConfig) ([]string, error) {
+	req, err := http.NewRequest("GET", MODELS_URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating models request: %v", err)
+	}
+
+	requestID := newRequestID()
+	addAPIHeaders(req, config, requestID)
+
+	client := newAPIClient(config, 10*time.Second)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching models: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading models response: %v", err)
+	}
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("models request failed (Status %d, request ID %s): %s",
+			resp.StatusCode, requestID, string(body))
+	}
+
+	var result struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return nil, fmt.Errorf("error parsing models response: %v", err)
+	}
+
+	var models []string
+	for _, model := range result.Data {
+		models = append(models, model.ID)
+	}
+	return models, nil
+}
+
+func refreshModelsCache(config *PromptConfig) (*ModelsCache, error) {
+	models, err := fetchModels(config)
+	if err != nil {
+		return nil, err
+	}
+
+	cache := &ModelsCache{FetchedAt: time.Now(), Models: models}
+	if err := saveModelsCache(cache); err != nil {
+		return nil, err
+	}
+	return cache, nil
+}
+
+// getAvailableModels returns the cached model list. A stale or missing cache is refreshed
+// in the background so startup isn't blocked; meanwhile the stale list is used, and nil is
+// returned (skipping validation) only when there is no cache at all. With force set the
+// list is always refetched before returning.
+func getAvailableModels(config *PromptConfig, force bool) ([]string, error) {
+	if force {
+		cache, err := refreshModelsCache(config)
+		if err != nil {
+			return nil, err
+		}
+		return cache.Models, nil
+	}
+
+	cache, err := loadModelsCache()
+	if err != nil {
+		go refreshModelsCache(config)
+		return nil, nil
+	}
+	if time.Since(cache.FetchedAt) >= modelsCacheTTL(config) {
+		go refreshModelsCache(config)
+	}
+	return cache.Models, nil
+}
+
+func validateModel(model string, models []string) error {
+	if len(models) == 0 {
+		return nil
+	}
+	for _, m := range models {
+		if m == model {
+			return nil
+		}
+	}
+	return fmt.Errorf("model %q is not in the list of available models", model)
+}
+
+// listModels prints the known models with their descriptions, marking which ones are
+// available to the configured API key when the model list can be retrieved
+func listModels() {
+	var available []string
+	if config, err := initializeVeniceConfig(); err == nil {
+		if cache, err := loadModelsCache(); err == nil && time.Since(cache.FetchedAt) < modelsCacheTTL(config) {
+			available = cache.Models
+		} else if cache, err := refreshModelsCache(config); err == nil {
+			available = cache.Models
+		} else {
+			fmt.Printf("Could not retrieve available models: %v\n\n", err)
+		}
+	}
+
+	isAvailable := func(id string) string {
+		if available == nil {
+			return ""
+		}
+		for _, model := range available {
+			if model == id {
+				return "available"
+			}
+		}
+		return "not available"
+	}
+
+	known := make(map[string]bool)
+	for _, model := range modelDescriptions {
+		known[model.id] = true
+		fmt.Printf("%-22s %-36s %s\n", model.id, model.description, isAvailable(model.id))
+	}
+
+	// Models offered by the API that this version doesn't know about yet
+	for _, model := range available {
+		if !known[model] {
+			fmt.Printf("%-22s %-36s %s\n", model, "(no description)", "available")
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// expandPath expands environment variables and a leading ~ in a configured path, so
+// "~/art" or "$HOME/art" don't create a literal "~" or "$HOME" folder
+func expandPath(path string, home string) string {
+	path = os.ExpandEnv(path)
+	if home == "" {
+		return path
+	}
+	if path == "~" {
+		return home
+	}
+	if strings.HasPrefix(path, "~/") || strings.HasPrefix(path, "~"+string(filepath.Separator)) {
+		return filepath.Join(home, path[2:])
+	}
+	return path
+}
+
+// homeDir is the current user's home folder for expandPath, "" when it can't be found
+func homeDir() string {
+	currentUser, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return currentUser.HomeDir
+}
+
+// expandPathFlags expands the command line paths like the configured ones, for the ~ a
+// shell leaves alone, e.g. in -watch=~/queue.jsonl or a quoted "$ART/fox.png"
+func expandPathFlags() {
+	home := homeDir()
+	for _, path := range []*string{configFile, outputFlag, queueFile, stopFile, archiveFile, exportFile, fromImage, cleanDir} {
+		if *path != "" && *path != "-" {
+			*path = expandPath(*path, home)
+		}
+	}
+}
+
+// checkRestrictedOutput rejects an output folder outside RestrictOutput, e.g. one a dir
+// template or prompt name walks out of with ".."
+func checkRestrictedOutput(outputDir string, config *PromptConfig, currentUser *user.User) error {
+	if config.RestrictOutput == "" {
+		return nil
+	}
+
+	base, err := filepath.Abs(expandPath(config.RestrictOutput, currentUser.HomeDir))
+	if err != nil {
+		return fmt.Errorf("error resolving restrict_output: %v", err)
+	}
+	dir, err := filepath.Abs(outputDir)
+	if err != nil {
+		return fmt.Errorf("error resolving output directory: %v", err)
+	}
+
+	rel, err := filepath.Rel(base, dir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("output directory %s is outside %s", dir, base)
+	}
+	return nil
+}
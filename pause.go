@@ -0,0 +1,21 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// batchPause sleeps for BatchPauseSec between batches of BatchPauseEvery images, counting
+// down in the status line. It returns early when the run is stopped.
+func batchPause(config *PromptConfig, done int) {
+	pause := time.Duration(config.BatchPauseSec) * time.Second
+	updatePromptLog([]string{fmt.Sprintf("\nPaused for %s after %d images", pause, done)})
+
+	for left := pause; left > 0; left -= time.Second {
+		if config.shouldStop() {
+			return
+		}
+		showStatus(fmt.Sprintf("Pausing after %d images, resuming in %s", done, left))
+		profileSleep(PhasePause, done, min(time.Second, left))
+	}
+}
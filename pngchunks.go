@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+)
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// Chunks that describe the color space; ForceSRGB replaces them with sRGB and gAMA
+var pngColorChunks = map[string]bool{"iCCP": true, "sRGB": true, "gAMA": true, "cHRM": true}
+
+// Text chunks hold the prompt and settings -from and the gallery read back, so StripMetadata
+// keeps them
+var pngTextChunks = map[string]bool{"tEXt": true, "iTXt": true, "zTXt": true}
+
+// pngChunk is one chunk of a PNG file, without its length and CRC
+type pngChunk struct {
+	kind string
+	data []byte
+}
+
+// critical reports whether a decoder needs the chunk to draw the image. tRNS is
+// ancillary but carries the transparency, so it counts too.
+func (c pngChunk) critical() bool {
+	return c.kind[0] >= 'A' && c.kind[0] <= 'Z' || c.kind == "tRNS"
+}
+
+// readPNGChunks splits a PNG file into its chunks, checking every CRC
+func readPNGChunks(data []byte) ([]pngChunk, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, fmt.Errorf("not a PNG file")
+	}
+	var chunks []pngChunk
+	rest := data[len(pngSignature):]
+	for len(rest) > 0 {
+		if len(rest) < 12 {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		length := binary.BigEndian.Uint32(rest[:4])
+		if uint64(length)+12 > uint64(len(rest)) {
+			return nil, fmt.Errorf("truncated PNG chunk")
+		}
+		body := rest[4 : 8+length]
+		if crc32.ChecksumIEEE(body) != binary.BigEndian.Uint32(rest[8+length:12+length]) {
+			return nil, fmt.Errorf("bad CRC in PNG %s chunk", body[:4])
+		}
+		chunks = append(chunks, pngChunk{string(body[:4]), body[4:]})
+		rest = rest[12+length:]
+	}
+	if len(chunks) == 0 || chunks[0].kind != "IHDR" {
+		return nil, fmt.Errorf("PNG doesn't start with IHDR")
+	}
+	return chunks, nil
+}
+
+func writePNGChunks(chunks []pngChunk) []byte {
+	var out bytes.Buffer
+	out.Write(pngSignature)
+	for _, chunk := range chunks {
+		binary.Write(&out, binary.BigEndian, uint32(len(chunk.data)))
+		body := append([]byte(chunk.kind), chunk.data...)
+		out.Write(body)
+		binary.Write(&out, binary.BigEndian, crc32.ChecksumIEEE(body))
+	}
+	return out.Bytes()
+}
+
+// colorManage applies StripMetadata and ForceSRGB to a PNG. Only chunks are dropped or
+// added, the pixels are copied as they are. Anything that isn't a PNG is returned unchanged.
+func colorManage(data []byte, stripMetadata, forceSRGB bool) ([]byte, error) {
+	if !stripMetadata && !forceSRGB {
+		return data, nil
+	}
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		return data, err
+	}
+
+	kept := []pngChunk{chunks[0]}
+	if forceSRGB {
+		// Rendering intent 0 (perceptual), with the gAMA the PNG spec pairs with sRGB
+		kept = append(kept, pngChunk{"sRGB", []byte{0}}, pngChunk{"gAMA", []byte{0, 0, 0xb1, 0x8f}})
+	}
+	for _, chunk := range chunks[1:] {
+		if stripMetadata && !chunk.critical() && !pngTextChunks[chunk.kind] {
+			continue
+		}
+		if forceSRGB && pngColorChunks[chunk.kind] {
+			continue
+		}
+		kept = append(kept, chunk)
+	}
+	return writePNGChunks(kept), nil
+}
+
+// colorManageImage applies the config's StripMetadata and ForceSRGB to a saved image's bytes,
+// keeping them as they were when the image can't be processed
+func colorManageImage(data []byte, config *PromptConfig) []byte {
+	managed, err := colorManage(data, config.StripMetadata, config.ForceSRGB)
+	if err != nil {
+		debugLog("Leaving the image as it is: %v", err)
+		return data
+	}
+	return managed
+}
+
+// colorManageFile is colorManageImage for an image already on disk
+func colorManageFile(path string, config *PromptConfig) error {
+	if !config.StripMetadata && !config.ForceSRGB {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, colorManageImage(data, config), 0644)
+}
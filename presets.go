@@ -0,0 +1,54 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// generatePresetSheet renders one image per style preset with the prompt, seed and cfg
+// held fixed, saving each under the preset's name so the presets can be compared side by side
+func generatePresetSheet(config *PromptConfig, elements *PromptElements) {
+	presets := elements.Style
+	if *presetFilter != "" {
+		presets = nil
+		for _, preset := range strings.Split(*presetFilter, ",") {
+			if preset = strings.TrimSpace(preset); preset != "" {
+				presets = append(presets, preset)
+			}
+		}
+	}
+	if len(presets) == 0 {
+		displayError("No style presets to generate")
+		return
+	}
+
+	config.NumImages = len(presets)
+	activeConfig = config
+
+	payload := newGenerateRequest(config)
+	payload.CfgScale = config.CfgScale
+	payload.Seed = randSource.ImageSeed(0)
+
+	for i := 0; i < len(presets); i++ {
+		if config.shouldStop() {
+			flushPromptLog()
+			break
+		}
+
+		if i > 0 {
+			time.Sleep(RATE_LIMIT)
+		}
+
+		payload.StylePreset = presets[i]
+		payload.FileLabel = presets[i]
+
+		updateProgress(i, len(presets),
+			payload.StylePreset,
+			"",
+			"Generating preset sheet...",
+			payload.Model,
+			payload.CfgScale)
+
+		i = requestImage(i, &payload, config)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The phases of a run that -profile times
+const (
+	PhaseRequest   = "API requests"
+	PhaseRateLimit = "rate-limit sleeps"
+	PhaseRetry     = "retry and backoff waits"
+	PhasePause     = "batch pauses"
+	PhaseSave      = "saving images"
+)
+
+var profilePhases = []string{PhaseRequest, PhaseRateLimit, PhaseRetry, PhasePause, PhaseSave}
+
+// runProfile collects where the wall-clock time of a run goes, per image index
+type runProfile struct {
+	mu     sync.Mutex
+	start  time.Time
+	totals map[string]time.Duration
+	images map[int]map[string]time.Duration
+}
+
+// profile is nil unless -profile was given, which makes profileSince a no-op
+var profile *runProfile
+
+func startProfile() {
+	profile = &runProfile{
+		start:  time.Now(),
+		totals: make(map[string]time.Duration),
+		images: make(map[int]map[string]time.Duration),
+	}
+}
+
+// profileSince adds the time since start to phase for image index i. Call it as
+// `defer profileSince(PhaseSave, i, time.Now())` or after the timed step.
+func profileSince(phase string, i int, start time.Time) {
+	if profile == nil {
+		return
+	}
+	elapsed := time.Since(start)
+
+	profile.mu.Lock()
+	defer profile.mu.Unlock()
+	profile.totals[phase] += elapsed
+	if profile.images[i] == nil {
+		profile.images[i] = make(map[string]time.Duration)
+	}
+	profile.images[i][phase] += elapsed
+}
+
+// profileSleep sleeps for d and counts it towards phase for image index i
+func profileSleep(phase string, i int, d time.Duration) {
+	start := time.Now()
+	time.Sleep(d)
+	profileSince(phase, i, start)
+}
+
+// printProfile writes the share of the run spent in each phase, the average per image and
+// a histogram of the time each image took
+func printProfile(w io.Writer) {
+	if profile == nil {
+		return
+	}
+	profile.mu.Lock()
+	defer profile.mu.Unlock()
+
+	wall := time.Since(profile.start)
+	fmt.Fprintf(w, "\nProfile of %s over %d images:\n", wall.Round(time.Millisecond), len(profile.images))
+
+	accounted := time.Duration(0)
+	for _, phase := range profilePhases {
+		accounted += profile.totals[phase]
+	}
+	other := max(0, wall-accounted)
+
+	for _, phase := range profilePhases {
+		printProfileLine(w, phase, profile.totals[phase], wall, len(profile.images))
+	}
+	printProfileLine(w, "everything else", other, wall, 0)
+
+	if len(profile.images) == 0 {
+		return
+	}
+
+	var perImage []time.Duration
+	for _, phases := range profile.images {
+		total := time.Duration(0)
+		for _, d := range phases {
+			total += d
+		}
+		perImage = append(perImage, total)
+	}
+	fmt.Fprintln(w, "\nTime per image:")
+	for _, line := range durationHistogram(perImage, 6, 30) {
+		fmt.Fprintln(w, line)
+	}
+}
+
+func printProfileLine(w io.Writer, name string, total, wall time.Duration, images int) {
+	share := 0.0
+	if wall > 0 {
+		share = float64(total) / float64(wall) * 100
+	}
+	line := fmt.Sprintf("  %5.1f%%  %-24s %10s", share, name, total.Round(time.Millisecond))
+	if images > 0 && total > 0 {
+		line += fmt.Sprintf("  (%s per image)", (total / time.Duration(images)).Round(time.Millisecond))
+	}
+	fmt.Fprintln(w, line)
+}
+
+// durationHistogram sorts durations into up to buckets equal ranges and draws one bar per
+// range, the longest bar width characters wide
+func durationHistogram(durations []time.Duration, buckets int, width int) []string {
+	if len(durations) == 0 || buckets < 1 {
+		return nil
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+	low, high := sorted[0], sorted[len(sorted)-1]
+
+	span := high - low
+	if span == 0 {
+		buckets = 1
+	}
+	counts := make([]int, buckets)
+	for _, d := range sorted {
+		bucket := 0
+		if span > 0 {
+			bucket = min(buckets-1, int(int64(d-low)*int64(buckets)/int64(span)))
+		}
+		counts[bucket]++
+	}
+
+	most := 0
+	for _, count := range counts {
+		most = max(most, count)
+	}
+
+	lines := make([]string, buckets)
+	for b, count := range counts {
+		from := low + span*time.Duration(b)/time.Duration(buckets)
+		to := low + span*time.Duration(b+1)/time.Duration(buckets)
+		bar := strings.Repeat("#", (count*width+most-1)/most)
+		lines[b] = fmt.Sprintf("  %8s - %-8s %-*s %d",
+			from.Round(100*time.Millisecond), to.Round(100*time.Millisecond), width, bar, count)
+	}
+	return lines
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"os/user"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How often the queue file is checked for new lines once everything has been processed
+const QUEUE_POLL = 2 * time.Second
+
+// queueOffsetPath is where the byte offset of the last processed queue line is recorded
+func queueOffsetPath(queuePath string) string {
+	return queuePath + ".offset"
+}
+
+func readQueueOffset(queuePath string) int64 {
+	data, err := os.ReadFile(queueOffsetPath(queuePath))
+	if err != nil {
+		return 0
+	}
+	offset, err := strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+	if err != nil || offset < 0 {
+		return 0
+	}
+	return offset
+}
+
+func writeQueueOffset(queuePath string, offset int64) error {
+	return os.WriteFile(queueOffsetPath(queuePath), []byte(strconv.FormatInt(offset, 10)), 0644)
+}
+
+// watchQueue tails queuePath and generates each line as it is appended. Every line is a
+// JSON object overlaid on the base config (e.g. {"prompt": "...", "num_images": 2}).
+// Processed lines are marked by recording their end offset so a restart resumes after them.
+func watchQueue(queuePath string, baseConfig *PromptConfig, elements *PromptElements, currentUser *user.User) error {
+	offset := readQueueOffset(queuePath)
+	waiting := false
+
+	for !interrupted && !stopRequested() {
+		line, next, err := readQueueLine(queuePath, offset)
+		if err != nil {
+			return err
+		}
+
+		// Nothing new (or only a partially written line), poll for more
+		if next == offset {
+			if !waiting && !quietMode {
+				if fullScreen() {
+					fmt.Print("\033[H\033[2J")
+				}
+				fmt.Printf("Waiting for new entries in %s ...\n", queuePath)
+			}
+			waiting = true
+			time.Sleep(QUEUE_POLL)
+			continue
+		}
+		waiting = false
+
+		if line != "" {
+			if err := generateQueueEntry(line, baseConfig, elements, currentUser); err != nil {
+				displayError("Queue entry skipped: %v", err)
+			}
+			// Leave the entry unprocessed so it runs again once the key or quota is fixed
+			if abortReason == AbortAuth {
+				return fmt.Errorf("the API rejected the key - check your API key")
+			}
+			if abortReason == AbortQuota {
+				return fmt.Errorf("the API quota is exhausted - top up and restart the queue")
+			}
+			time.Sleep(RATE_LIMIT)
+		}
+
+		offset = next
+		if err := writeQueueOffset(queuePath, offset); err != nil {
+			return fmt.Errorf("error recording queue position: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// readQueueLine returns the next complete line at offset and the offset just past it.
+// A trailing line without a newline is still being written, so it isn't consumed yet.
+func readQueueLine(queuePath string, offset int64) (string, int64, error) {
+	f, err := os.Open(queuePath)
+	if err != nil {
+		return "", offset, fmt.Errorf("error opening queue file: %v", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return "", offset, fmt.Errorf("error reading queue file: %v", err)
+	}
+
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err == io.EOF {
+		return "", offset, nil
+	}
+	if err != nil {
+		return "", offset, fmt.Errorf("error reading queue file: %v", err)
+	}
+
+	return strings.TrimSpace(line), offset + int64(len(line)), nil
+}
+
+// cloneConfig copies config deeply enough that unmarshalling a queue entry into the copy
+// leaves config alone: json.Unmarshal adds to existing maps, fills existing pointers in
+// place and reuses a slice's backing array
+func cloneConfig(config *PromptConfig) PromptConfig {
+	clone := *config
+	clone.APIKeys = slices.Clone(config.APIKeys)
+	clone.StyleList = slices.Clone(config.StyleList)
+	clone.Extra = maps.Clone(config.Extra)
+	clone.NegativePromptsByModel = maps.Clone(config.NegativePromptsByModel)
+	clone.CategoryProbability = maps.Clone(config.CategoryProbability)
+	clone.CategoryRamp = maps.Clone(config.CategoryRamp)
+	clone.UniqueAcrossBatch = maps.Clone(config.UniqueAcrossBatch)
+	if config.ClearOnExit != nil {
+		clearOnExit := *config.ClearOnExit
+		clone.ClearOnExit = &clearOnExit
+	}
+	if config.S3 != nil {
+		s3 := *config.S3
+		clone.S3 = &s3
+	}
+	return clone
+}
+
+func generateQueueEntry(line string, baseConfig *PromptConfig, elements *PromptElements, currentUser *user.User) error {
+	entry := cloneConfig(baseConfig)
+	// An entry makes one image unless it says otherwise, not prompt.json's num_images
+	entry.NumImages = 0
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		return fmt.Errorf("error parsing queue entry: %v", err)
+	}
+	if entry.NumImages <= 0 {
+		entry.NumImages = 1
+	}
+
+	// The run's command line overrides (-n, -dims, -cfg, -steps, -enable, ...) apply to
+	// every entry, as they do to a plain run
+	applyFlagOverrides(&entry)
+	if len(entry.Prompt) > MaxPromptLength {
+		return fmt.Errorf("prompt is longer than %d characters", MaxPromptLength)
+	}
+
+	outputDir, useSubDir, err := getOutputDirectory(&entry, currentUser)
+	if err != nil {
+		return fmt.Errorf("error creating output directory: %v", err)
+	}
+	entry.OutputDir = outputDir
+	entry.NameAsSubDir = useSubDir
+
+	if err := initPromptLog(&entry); err != nil {
+		return fmt.Errorf("error initializing Prompt Log: %v", err)
+	}
+
+	// Each entry gets its own failure allowance
+	resetRunCounters()
+	if fullScreen() {
+		fmt.Print("\033[H\033[2J")
+	}
+	runStarted = time.Now()
+	generateBatch(&entry, elements, "")
+	closePromptLog()
+	if abortReason != "" {
+		notifyWebhook(&entry, "aborted", "🛑 Venice queue entry stopped ("+abortReason+"): "+entry.PromptName)
+	} else {
+		notifyWebhook(&entry, "complete", "✨ Venice queue entry complete: "+entry.PromptName)
+	}
+
+	return nil
+}
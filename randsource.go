@@ -0,0 +1,72 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"math"
+	mrand "math/rand"
+	"time"
+)
+
+// MAX_SEED bounds the image seeds venice generates
+const MAX_SEED = 99_999_999
+
+// RandSource supplies the random choices of a run that enhance_seed doesn't cover: cfg
+// scales, element picks and category chances without an enhance_seed, and image seeds
+type RandSource interface {
+	Float64() float64          // a value in [0, 1)
+	Intn(n int) int            // a value in [0, n)
+	ImageSeed(index int) int64 // the seed for image index of the batch
+}
+
+// randSource is the source of the run: entropy by default, a seeded one with -deterministic
+var randSource RandSource = entropySource{}
+
+// entropySource draws from crypto/rand and derives seeds from the clock
+type entropySource struct{}
+
+func (entropySource) Float64() float64 {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return float64(binary.BigEndian.Uint64(b)) / float64(math.MaxUint64)
+}
+
+func (entropySource) Intn(n int) int {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return int(binary.BigEndian.Uint64(b) % uint64(n))
+}
+
+func (entropySource) ImageSeed(index int) int64 {
+	return time.Now().UnixNano()%MAX_SEED + int64(index)
+}
+
+// deterministicSource replays the same sequence of choices and seeds for the same seed
+type deterministicSource struct {
+	seed  int64
+	draws int64 // values taken from the sequence, saved in the run state for -resume
+	r     *mrand.Rand
+}
+
+func newDeterministicSource(seed int64) *deterministicSource {
+	return resumeDeterministicSource(seed, 0)
+}
+
+// resumeDeterministicSource continues the sequence of seed after its first draws values
+func resumeDeterministicSource(seed int64, draws int64) *deterministicSource {
+	s := &deterministicSource{seed: seed}
+	s.r = mrand.New(newCountingSource(seed, draws, &s.draws))
+	return s
+}
+
+func (s *deterministicSource) Float64() float64 {
+	return s.r.Float64()
+}
+
+func (s *deterministicSource) Intn(n int) int {
+	return s.r.Intn(n)
+}
+
+func (s *deterministicSource) ImageSeed(index int) int64 {
+	return s.r.Int63n(MAX_SEED)
+}
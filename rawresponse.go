@@ -0,0 +1,27 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// saveRawResponse writes the undecoded API response next to the image as <image>.raw when
+// SaveRawResponse is set, so a malformed image can be traced to the API, the decode or the
+// write. Without an image filename (the response couldn't be decoded) it is named after
+// the request ID instead. It returns the file written, "" when nothing was.
+func saveRawResponse(config *PromptConfig, payload *GenerateRequest, filename string, raw []byte) string {
+	if !config.SaveRawResponse || len(raw) == 0 {
+		return ""
+	}
+
+	rawPath := filename + ".raw"
+	if filename == "" {
+		rawPath = filepath.Join(config.OutputDir, "response-"+payload.RequestID+".raw")
+	}
+	if err := os.WriteFile(rawPath, raw, 0644); err != nil {
+		displayError("Error saving raw response: %v", err)
+		return ""
+	}
+	updatePromptLog([]string{"\nRaw Response: ", filepath.Base(rawPath)})
+	return rawPath
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// recentImage looks for an image newer than maxAge where this run would write its output
+// and returns its path and age. With NameAsSubDir only this prompt's folders (including
+// timestamped ones from earlier runs) are searched.
+func recentImage(config *PromptConfig, baseDir string, maxAge time.Duration) (string, time.Duration) {
+	dirs := []string{baseDir}
+	if config.NameAsSubDir && config.PromptName != "" {
+		dirs = []string{filepath.Join(baseDir, config.PromptName)}
+		stamped, _ := filepath.Glob(filepath.Join(baseDir, config.PromptName+"_*"))
+		dirs = append(dirs, stamped...)
+	}
+
+	encodedExt := strings.ToLower(filepath.Ext(encodedPath("image.png", config)))
+
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() || !isImageName(entry.Name(), encodedExt) {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue
+			}
+			if age := time.Since(info.ModTime()); age < maxAge {
+				return filepath.Join(dir, entry.Name()), age
+			}
+		}
+	}
+	return "", 0
+}
+
+func isImageName(name, encodedExt string) bool {
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".png", ".jpg", ".jpeg":
+		return true
+	default:
+		return ext != "" && ext == encodedExt
+	}
+}
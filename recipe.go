@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// imageRecipe is what could be recovered about how an image was generated. Zero fields
+// weren't found and keep the value from prompt.json.
+type imageRecipe struct {
+	GenerateRequest
+	PromptName string
+	Sources    []string
+}
+
+// The seed and cfg scale as they appear in generated filenames, e.g.
+// "fox-3.0_seed1234_scale7.5.png" or "fox-seed1234.png" from a seed sweep
+var filenameRecipe = regexp.MustCompile(`[-_]seed(\d+)(?:\.\d+)?(?:_scale(\d+(?:\.\d+)?))?`)
+
+// loadImageRecipe recovers the settings behind an image for -from, which needs at least
+// the prompt
+func loadImageRecipe(imagePath string, logName string) (*imageRecipe, error) {
+	recipe, err := readImageRecipe(imagePath, logName)
+	if err != nil {
+		return nil, err
+	}
+	if recipe.Prompt == "" {
+		return nil, fmt.Errorf("no prompt found for %s (looked for %s, PNG metadata and a .json sidecar)",
+			filepath.Base(imagePath), logName)
+	}
+	return recipe, nil
+}
+
+// readImageRecipe collects whatever is known about how an image was generated. Each
+// source fills in what it knows, later ones taking precedence: the filename (seed, scale),
+// the PromptLog entry for the image (prompt, style, model), text chunks embedded in the
+// PNG and a <image>.json sidecar with request fields (prompt, seed, cfg_scale, steps, ...).
+func readImageRecipe(imagePath string, logName string) (*imageRecipe, error) {
+	if _, err := os.Stat(imagePath); err != nil {
+		return nil, fmt.Errorf("error opening image: %v", err)
+	}
+	recipe := &imageRecipe{}
+
+	if m := filenameRecipe.FindStringSubmatch(filepath.Base(imagePath)); m != nil {
+		recipe.Seed, _ = strconv.ParseInt(m[1], 10, 64)
+		if m[2] != "" {
+			recipe.CfgScale, _ = strconv.ParseFloat(m[2], 64)
+		}
+		recipe.Sources = append(recipe.Sources, "filename")
+	}
+
+	// With group_by_style or max_images_per_dir the image can be up to two folders below the log
+	dir := filepath.Dir(imagePath)
+	for _, dir := range []string{dir, filepath.Dir(dir), filepath.Dir(filepath.Dir(dir))} {
+		found, err := readLogRecipe(filepath.Join(dir, logName), imagePath, recipe)
+		if err != nil {
+			return nil, err
+		}
+		if found {
+			recipe.Sources = append(recipe.Sources, logName)
+			break
+		}
+	}
+
+	chunks, err := readPNGText(imagePath)
+	if err != nil {
+		return nil, err
+	}
+	if len(chunks) > 0 {
+		for key, value := range chunks {
+			setRecipeField(recipe, key, value)
+		}
+		recipe.Sources = append(recipe.Sources, "PNG metadata")
+	}
+
+	sidecar := strings.TrimSuffix(imagePath, filepath.Ext(imagePath)) + ".json"
+	if data, err := os.ReadFile(sidecar); err == nil {
+		var fields GenerateRequest
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return nil, fmt.Errorf("error parsing %s: %v", sidecar, err)
+		}
+		mergeRecipe(recipe, &fields)
+		recipe.Sources = append(recipe.Sources, filepath.Base(sidecar))
+	}
+	return recipe, nil
+}
+
+// readLogRecipe finds the entry for image in a prompt log and fills in the prompt, style
+// and model from it and the run header above it
+func readLogRecipe(logPath string, image string, recipe *imageRecipe) (bool, error) {
+	f, err := os.Open(logPath)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error opening %s: %v", logPath, err)
+	}
+	defer f.Close()
+
+	// Encoded images are logged under their original PNG name
+	want := strings.TrimSuffix(filepath.Base(image), filepath.Ext(image))
+
+	var model, name, base string
+	found := false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		key, value, _ := strings.Cut(line, ":")
+		value = strings.TrimSpace(value)
+
+		if found {
+			switch key {
+			case "Image Style":
+				recipe.StylePreset = value
+			case "Negative":
+				recipe.NegativePrompt = value
+			case "Elements":
+				recipe.Prompt = joinPromptParts(base, value)
+			}
+			if strings.HasPrefix(line, "=====> File:") {
+				break
+			}
+			continue
+		}
+
+		switch {
+		case key == "Model":
+			model = value
+		case key == "Prompt Name":
+			name = value
+		case key == "Base Prompt":
+			base = value
+		case strings.HasPrefix(line, "=====> File:"):
+			logged := strings.TrimSpace(strings.TrimPrefix(line, "=====> File:"))
+			if strings.TrimSuffix(filepath.Base(logged), filepath.Ext(logged)) == want {
+				found = true
+				recipe.Model, recipe.PromptName, recipe.Prompt = model, name, base
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, fmt.Errorf("error reading %s: %v", logPath, err)
+	}
+	return found, nil
+}
+
+// readPNGText returns the tEXt chunks of a PNG file as keyword/text pairs. A file that
+// isn't a PNG (e.g. after an external encoder) or is damaged has none.
+func readPNGText(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error opening image: %v", err)
+	}
+	chunks, err := readPNGChunks(data)
+	if err != nil {
+		debugLog("No PNG metadata in %s: %v", path, err)
+		return nil, nil
+	}
+
+	text := make(map[string]string)
+	for _, chunk := range chunks {
+		if chunk.kind != "tEXt" {
+			continue
+		}
+		if key, value, ok := bytes.Cut(chunk.data, []byte{0}); ok {
+			text[string(key)] = string(value)
+		}
+	}
+	return text, nil
+}
+
+// setRecipeField applies one embedded key/value using the API's request field names
+func setRecipeField(recipe *imageRecipe, key string, value string) {
+	value = strings.TrimSpace(value)
+	switch strings.ToLower(key) {
+	case "prompt":
+		recipe.Prompt = value
+	case "negative_prompt":
+		recipe.NegativePrompt = value
+	case "model":
+		recipe.Model = value
+	case "style_preset":
+		recipe.StylePreset = value
+	case "seed":
+		if seed, err := strconv.ParseInt(value, 10, 64); err == nil {
+			recipe.Seed = seed
+		}
+	case "cfg_scale":
+		if cfg, err := strconv.ParseFloat(value, 64); err == nil {
+			recipe.CfgScale = cfg
+		}
+	case "steps":
+		recipe.Steps, _ = strconv.Atoi(value)
+	case "width":
+		recipe.Width, _ = strconv.Atoi(value)
+	case "height":
+		recipe.Height, _ = strconv.Atoi(value)
+	}
+}
+
+// mergeRecipe copies the fields that are set in fields over the recipe
+func mergeRecipe(recipe *imageRecipe, fields *GenerateRequest) {
+	if fields.Prompt != "" {
+		recipe.Prompt = fields.Prompt
+	}
+	if fields.NegativePrompt != "" {
+		recipe.NegativePrompt = fields.NegativePrompt
+	}
+	if fields.Model != "" {
+		recipe.Model = fields.Model
+	}
+	if fields.StylePreset != "" {
+		recipe.StylePreset = fields.StylePreset
+	}
+	if fields.Seed != 0 {
+		recipe.Seed = fields.Seed
+	}
+	if fields.CfgScale != 0 {
+		recipe.CfgScale = fields.CfgScale
+	}
+	if fields.Steps != 0 {
+		recipe.Steps = fields.Steps
+	}
+	if fields.Width != 0 {
+		recipe.Width = fields.Width
+	}
+	if fields.Height != 0 {
+		recipe.Height = fields.Height
+	}
+}
+
+// applyRecipe turns the config into a regeneration of the recipe: the recorded prompt
+// is used as is (no random elements), with its style, model and settings, and the
+// image's seed is generated again as a one image seed sweep. -seed-sweep, -sweep-count,
+// -cfg, -steps and the other command line flags still override the recovered values.
+func applyRecipe(config *PromptConfig, recipe *imageRecipe) {
+	config.Prompt = recipe.Prompt
+	if recipe.PromptName != "" {
+		config.PromptName = recipe.PromptName
+	}
+	if recipe.NegativePrompt != "" {
+		config.NegativePrompt = recipe.NegativePrompt
+		config.NegativePromptsByModel = nil
+	}
+	if recipe.Model != "" {
+		config.Model = recipe.Model
+	}
+	if recipe.CfgScale != 0 {
+		config.CfgScale = recipe.CfgScale
+		config.FixedCfg = true
+	}
+	if recipe.Steps != 0 {
+		config.Steps = recipe.Steps
+	}
+	if recipe.Width != 0 && recipe.Height != 0 {
+		config.Width, config.Height = recipe.Width, recipe.Height
+	}
+	config.StyleMode = "fixed"
+	config.StylePreset = recipe.StylePreset
+
+	set := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if !set["seed-sweep"] {
+		*seedSweep = recipe.Seed
+		if recipe.Seed == 0 {
+			// Unknown seed, so it's a new image from the same prompt and settings
+			*seedSweep = randSource.ImageSeed(0)
+		}
+	}
+	if !set["sweep-count"] {
+		*sweepCount = 1
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dirImageCounts is how many images each folder holds. A folder is read once, the first
+// time the batch saves into it, and then counted in memory as images are saved.
+var dirImageCounts = make(map[string]int)
+
+// resetDirImageCounts makes the next batch read its folders again
+func resetDirImageCounts() {
+	dirImageCounts = make(map[string]int)
+}
+
+// rolloverDir returns the folder the next image goes in when a folder may hold at most
+// max images: dir itself until it is full, then part2, part3, ... inside it
+func rolloverDir(dir string, max int, config *PromptConfig) (string, error) {
+	encodedExt := strings.ToLower(filepath.Ext(encodedPath("image.png", config)))
+	for part := 1; ; part++ {
+		partDir := dir
+		if part > 1 {
+			partDir = filepath.Join(dir, fmt.Sprintf("part%d", part))
+		}
+		count, ok := dirImageCounts[partDir]
+		if !ok {
+			count = countImages(partDir, encodedExt)
+			dirImageCounts[partDir] = count
+		}
+		if count < max {
+			if err := os.MkdirAll(partDir, 0755); err != nil {
+				return dir, err
+			}
+			return partDir, nil
+		}
+	}
+}
+
+// countSavedImage adds an image saved at path to its folder's count. Folders rolloverDir
+// hasn't counted are left alone.
+func countSavedImage(path string) {
+	dir := filepath.Dir(path)
+	if count, ok := dirImageCounts[dir]; ok {
+		dirImageCounts[dir] = count + 1
+	}
+}
+
+// countImages counts the image files directly in dir; a missing dir has none
+func countImages(dir, encodedExt string) int {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0
+	}
+	count := 0
+	for _, entry := range entries {
+		if !entry.IsDir() && isImageName(entry.Name(), encodedExt) {
+			count++
+		}
+	}
+	return count
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	mrand "math/rand"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+// RUN_STATE_FILE in ~/.venice records how far the current run got, for -resume
+const RUN_STATE_FILE = "run_state.json"
+
+// runState is enough to continue an interrupted run exactly where it stopped: the image
+// to generate next and the position in the element selection sequence
+type runState struct {
+	PromptName    string               `json:"prompt_name"`
+	Prompt        string               `json:"prompt"`
+	EnhanceSeed   int64                `json:"enhance_seed"`
+	Draws         int64                `json:"draws"`                   // values taken from the selection source
+	Deterministic *int64               `json:"deterministic,omitempty"` // the -deterministic seed
+	RandDraws     int64                `json:"rand_draws,omitempty"`    // values taken from it
+	NextImage     int                  `json:"next_image"`
+	NumImages     int                  `json:"num_images"`
+	OutputDir     string               `json:"output_dir"`
+	NameAsSubDir  bool                 `json:"name_as_subdir"`
+	Decks         map[string]deckState `json:"decks,omitempty"`
+	Saved         time.Time            `json:"saved"`
+}
+
+// deckState is an elementDeck as saved in the run state
+type deckState struct {
+	Items []string `json:"items"`
+	Queue []string `json:"queue"`
+	Last  string   `json:"last"`
+}
+
+// runStatePath is where the run state is kept, empty when this run doesn't track it
+var runStatePath string
+
+// runOutputDir is the run's output folder before any rollover into part folders
+var runOutputDir string
+
+// resumeState is the saved state -resume continues from, until generateBatch applies it
+var resumeState *runState
+
+// selectionDraws counts the values selectionRand has taken from its source since it was seeded
+var selectionDraws int64
+
+// countingSource is a math/rand source that counts its draws in *draws, so the sequence
+// can be resumed by seeding a new source and skipping that many values
+type countingSource struct {
+	src   mrand.Source64
+	draws *int64
+}
+
+func (s countingSource) Int63() int64 {
+	*s.draws++
+	return s.src.Int63()
+}
+
+func (s countingSource) Uint64() uint64 {
+	*s.draws++
+	return s.src.Uint64()
+}
+
+func (s countingSource) Seed(seed int64) {
+	*s.draws = 0
+	s.src.Seed(seed)
+}
+
+// newCountingSource seeds a source counting into draws and skips the first skip values
+func newCountingSource(seed int64, skip int64, draws *int64) countingSource {
+	src := mrand.NewSource(seed).(mrand.Source64)
+	for n := int64(0); n < skip; n++ {
+		src.Int63()
+	}
+	*draws = skip
+	return countingSource{src, draws}
+}
+
+// newSelectionSource seeds a counting source and skips the first draws values
+func newSelectionSource(seed int64, draws int64) countingSource {
+	return newCountingSource(seed, draws, &selectionDraws)
+}
+
+// trackRunState turns on saving the run state to ~/.venice for this run
+func trackRunState(currentUser *user.User) {
+	runStatePath = filepath.Join(currentUser.HomeDir, ".venice", RUN_STATE_FILE)
+}
+
+// saveRunState records that image next is the one to generate now
+func saveRunState(config *PromptConfig, next int) {
+	if runStatePath == "" {
+		return
+	}
+	state := runState{
+		PromptName:   config.PromptName,
+		Prompt:       config.Prompt,
+		EnhanceSeed:  config.EnhanceSeed,
+		Draws:        selectionDraws,
+		NextImage:    next,
+		NumImages:    config.NumImages,
+		OutputDir:    runOutputDir,
+		NameAsSubDir: config.NameAsSubDir,
+		Decks:        make(map[string]deckState),
+		Saved:        time.Now(),
+	}
+	for name, deck := range elementDecks {
+		state.Decks[name] = deckState{Items: deck.items, Queue: deck.queue, Last: deck.last}
+	}
+	if source, ok := randSource.(*deterministicSource); ok {
+		seed := source.seed
+		state.Deterministic, state.RandDraws = &seed, source.draws
+	}
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		debugLog("Error encoding run state: %v", err)
+		return
+	}
+	// Write to a temp file first so Ctrl+C or a crash mid-write can't leave a state that
+	// -resume can't read
+	tmpPath := runStatePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		debugLog("Error saving run state: %v", err)
+		return
+	}
+	if err := os.Rename(tmpPath, runStatePath); err != nil {
+		debugLog("Error saving run state: %v", err)
+	}
+}
+
+// clearRunState removes the run state once the run has finished every image
+func clearRunState() {
+	if runStatePath != "" {
+		os.Remove(runStatePath)
+	}
+}
+
+// loadRunState reads the state of the last unfinished run and checks it belongs to config.
+// The prompt is compared separately once the command line overrides are applied.
+func loadRunState(currentUser *user.User, config *PromptConfig) (*runState, error) {
+	path := filepath.Join(currentUser.HomeDir, ".venice", RUN_STATE_FILE)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("there is no unfinished run to resume")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s: %v", path, err)
+	}
+
+	var state runState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	if state.PromptName != config.PromptName {
+		return nil, fmt.Errorf("the unfinished run was for %q, prompt.json now has %q", state.PromptName, config.PromptName)
+	}
+	if state.EnhanceSeed != config.EnhanceSeed {
+		return nil, fmt.Errorf("the unfinished run used enhance_seed %d, prompt.json now has %d",
+			state.EnhanceSeed, config.EnhanceSeed)
+	}
+	source, deterministic := randSource.(*deterministicSource)
+	switch {
+	case state.Deterministic != nil && !deterministic:
+		return nil, fmt.Errorf("the unfinished run used -deterministic %d, add it to continue the same sequence", *state.Deterministic)
+	case state.Deterministic == nil && deterministic:
+		return nil, fmt.Errorf("the unfinished run didn't use -deterministic, so its sequence can't be continued")
+	case deterministic && *state.Deterministic != source.seed:
+		return nil, fmt.Errorf("the unfinished run used -deterministic %d, not %d", *state.Deterministic, source.seed)
+	}
+	if state.NextImage >= state.NumImages {
+		return nil, fmt.Errorf("the last run already finished all %d images", state.NumImages)
+	}
+	return &state, nil
+}
+
+// applyResumeState puts the element selection, and the -deterministic sequence, back where
+// the saved run left it
+func applyResumeState(state *runState) {
+	if state.EnhanceSeed != 0 {
+		selectionRand = mrand.New(newSelectionSource(state.EnhanceSeed, state.Draws))
+	}
+	if state.Deterministic != nil {
+		randSource = resumeDeterministicSource(*state.Deterministic, state.RandDraws)
+	}
+	resetElementDecks()
+	for name, deck := range state.Decks {
+		elementDecks[name] = &elementDeck{items: deck.Items, queue: deck.Queue, last: deck.Last}
+	}
+}
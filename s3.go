@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// How long one upload may take before it is given up on
+const S3_UPLOAD_TIMEOUT = 2 * time.Minute
+
+// S3Config is a bucket on any S3-compatible store (AWS, MinIO, R2, B2, ...) that images
+// are uploaded to. The keys fall back to AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.
+type S3Config struct {
+	Endpoint  string `json:"endpoint"` // e.g. "https://s3.us-east-1.amazonaws.com"
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix,omitempty"`
+	Region    string `json:"region,omitempty"` // default us-east-1
+	AccessKey string `json:"access_key,omitempty"`
+	SecretKey string `json:"secret_key,omitempty"`
+
+	// Keep the local copy of each image after it is uploaded
+	KeepLocal bool `json:"keep_local,omitempty"`
+}
+
+// s3Sink uploads images with path-style PUT requests signed with AWS Signature Version 4
+type s3Sink struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// newS3Sink checks the S3 block and fills in the defaults
+func newS3Sink(s3 *S3Config) (*s3Sink, error) {
+	if s3.Endpoint == "" || s3.Bucket == "" {
+		return nil, fmt.Errorf("s3 needs an endpoint and a bucket")
+	}
+	endpoint, err := url.Parse(strings.TrimSuffix(s3.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return nil, fmt.Errorf("s3 endpoint %q is not an http(s) URL", s3.Endpoint)
+	}
+
+	sink := &s3Sink{
+		endpoint:  endpoint,
+		bucket:    s3.Bucket,
+		prefix:    s3.Prefix,
+		region:    s3.Region,
+		accessKey: s3.AccessKey,
+		secretKey: s3.SecretKey,
+		client:    &http.Client{Timeout: S3_UPLOAD_TIMEOUT},
+	}
+	if sink.region == "" {
+		sink.region = "us-east-1"
+	}
+	// "venice", "venice/" and "/venice/" all put images in the venice/ folder
+	if sink.prefix = strings.Trim(sink.prefix, "/"); sink.prefix != "" {
+		sink.prefix += "/"
+	}
+	if sink.accessKey == "" {
+		sink.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if sink.secretKey == "" {
+		sink.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if sink.accessKey == "" || sink.secretKey == "" {
+		return nil, fmt.Errorf("s3 needs access_key and secret_key (or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY)")
+	}
+	return sink, nil
+}
+
+// Save uploads data under the prefix followed by name, with meta as object metadata
+func (s *s3Sink) Save(ctx context.Context, name string, data []byte, meta Metadata) error {
+	key := s.prefix + name
+	target := *s.endpoint
+	target.Path = s.endpoint.Path + "/" + s.bucket + "/" + key
+	target.RawPath = s.endpoint.Path + "/" + uriEncode(s.bucket, false) + "/" + uriEncode(key, false)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target.String(), bytes.NewReader(data))
+	if err != nil {
+		return fmt.Errorf("error creating upload request: %v", err)
+	}
+	req.Header.Set("Content-Type", http.DetectContentType(data))
+	for name, value := range s3MetaHeaders(meta) {
+		req.Header.Set(name, value)
+	}
+	signS3Request(req, data, s.accessKey, s.secretKey, s.region, time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error uploading %s: %v", key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("uploading %s failed with status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// S3_META_PROMPT_MAX keeps the prompt within S3's 2 KB limit on user metadata
+const S3_META_PROMPT_MAX = 1024
+
+// s3MetaHeaders turns meta into x-amz-meta-* headers. S3 only stores ASCII metadata, so a
+// prompt with other characters is left out (PromptLog.txt still has it), and a long one is cut.
+func s3MetaHeaders(meta Metadata) map[string]string {
+	headers := map[string]string{
+		"X-Amz-Meta-Seed":  strconv.FormatInt(meta.Seed, 10),
+		"X-Amz-Meta-Cfg":   strconv.FormatFloat(meta.CfgScale, 'f', -1, 64),
+		"X-Amz-Meta-Steps": strconv.Itoa(meta.Steps),
+	}
+	if meta.Model != "" {
+		headers["X-Amz-Meta-Model"] = meta.Model
+	}
+	if meta.StylePreset != "" {
+		headers["X-Amz-Meta-Style"] = meta.StylePreset
+	}
+	if meta.RequestID != "" {
+		headers["X-Amz-Meta-Request-Id"] = meta.RequestID
+	}
+	if prompt := strings.Join(strings.Fields(meta.Prompt), " "); prompt != "" && isPrintableASCII(prompt) {
+		if len(prompt) > S3_META_PROMPT_MAX {
+			prompt = prompt[:S3_META_PROMPT_MAX]
+		}
+		headers["X-Amz-Meta-Prompt"] = prompt
+	}
+	return headers
+}
+
+func isPrintableASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < ' ' || s[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// signS3Request adds the x-amz-date, x-amz-content-sha256 and Authorization headers for
+// AWS Signature Version 4. The host and every x-amz-* header are signed.
+func signS3Request(req *http.Request, body []byte, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "date" {
+			headers[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), day)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// uriEncode percent-encodes everything but the unreserved characters, the way SigV4
+// expects; slashes are kept unless encodeSlash is set
+func uriEncode(s string, encodeSlash bool) string {
+	var out strings.Builder
+	for _, b := range []byte(s) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~':
+			out.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			out.WriteByte(b)
+		default:
+			fmt.Fprintf(&out, "%%%02X", b)
+		}
+	}
+	return out.String()
+}
+
+func canonicalQuery(values url.Values) string {
+	var pairs []string
+	for name, list := range values {
+		for _, value := range list {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// categoryItems returns the elements of the named category from elements.json
+func categoryItems(elements *PromptElements, name string) ([]string, error) {
+	switch strings.ToLower(name) {
+	case "face":
+		return elements.Face, nil
+	case "type":
+		return elements.Type, nil
+	case "hair":
+		return elements.Hair, nil
+	case "eyes":
+		return elements.Eyes, nil
+	case "clothing":
+		return elements.Clothing, nil
+	case "style":
+		return elements.Style, nil
+	case "style_keywords":
+		return elements.StyleKeywords, nil
+	case "poses":
+		return elements.Poses, nil
+	case "accessories":
+		return elements.Accessories, nil
+	case "backgrounds":
+		return elements.Backgrounds, nil
+	case "dirty":
+		return elements.Dirty, nil
+	default:
+		return nil, fmt.Errorf("unknown category %q", name)
+	}
+}
+
+// generateCategorySamples renders one image per element of a category, each with just the
+// base prompt and that element. The seed and cfg are held fixed so the element is the only
+// difference between images, and each file is named after its element.
+func generateCategorySamples(config *PromptConfig, elements *PromptElements, category string) {
+	items, err := categoryItems(elements, category)
+	if err != nil {
+		displayError("Cannot sample: %v", err)
+		return
+	}
+	if len(items) == 0 {
+		displayError("Category %s has no elements to sample", category)
+		return
+	}
+
+	config.NumImages = len(items)
+	activeConfig = config
+
+	payload := newGenerateRequest(config)
+	payload.CfgScale = config.CfgScale
+	payload.Seed = randSource.ImageSeed(0)
+
+	// Style elements are presets rather than prompt text
+	isStyle := strings.EqualFold(category, "style")
+
+	for i := 0; i < len(items); i++ {
+		if config.shouldStop() {
+			flushPromptLog()
+			break
+		}
+
+		if i > 0 {
+			time.Sleep(RATE_LIMIT)
+		}
+
+		item := strings.TrimSpace(items[i])
+		if isStyle {
+			payload.StylePreset = item
+		} else if config.Prompt != "" {
+			payload.Prompt = config.Prompt + ", " + item
+		} else {
+			payload.Prompt = item
+		}
+		payload.FileLabel = item
+
+		updateProgress(i, len(items),
+			payload.StylePreset,
+			item,
+			"Sampling "+category+"...",
+			payload.Model,
+			payload.CfgScale)
+
+		i = requestImage(i, &payload, config)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+)
+
+// SHUTDOWN_TIMEOUT bounds the cleanup after Ctrl+C in case a write hangs
+const SHUTDOWN_TIMEOUT = 3 * time.Second
+
+// runCtx is cancelled on interrupt so the request in flight is abandoned right away
+var runCtx, cancelRun = context.WithCancel(context.Background())
+
+// handleInterrupt waits for the first signal, then stops the run and exits once the logs
+// are written, or after SHUTDOWN_TIMEOUT. The -json summary is still printed. A second
+// signal exits straight away.
+func handleInterrupt(sigChan chan os.Signal) {
+	<-sigChan
+	interrupted = true
+	cancelRun()
+
+	go func() {
+		<-sigChan
+		os.Exit(1)
+	}()
+
+	done := make(chan struct{})
+	go func() {
+		writeInterruptCheckpoint()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(SHUTDOWN_TIMEOUT):
+		fmt.Fprintln(os.Stderr, "Timed out writing the logs, exiting anyway")
+	}
+
+	if fullScreen() {
+		leaveProgressDisplay(currentConfig())
+	}
+	// Clear any pending ANSI commands, flush buffered output, and restore terminal
+	fmt.Print("\033[?25h\033[0m") // Show cursor, reset colors
+	if *jsonSummary && activeConfig != nil {
+		printRunSummary(activeConfig)
+	}
+	os.Stdout.Sync() // Flush any buffered output
+	os.Exit(1)
+}
+
+// writeInterruptCheckpoint records in the prompt log how far the run got and closes it,
+// then finishes the -archive file with it and removes any -interactive drafts
+func writeInterruptCheckpoint() {
+	if activeConfig != nil {
+		updatePromptLog([]string{fmt.Sprintf("\n\nRun interrupted at %s after %d of %d images\n",
+			time.Now().Format("2006-01-02 15:04:05"), stats.Stored(), activeConfig.NumImages)})
+	}
+	closePromptLog()
+	finishArchive()
+	if interactiveDrafts != "" {
+		os.RemoveAll(interactiveDrafts)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Metadata is how an image was made, stored alongside it by sinks that can
+type Metadata struct {
+	Prompt         string
+	NegativePrompt string
+	Model          string
+	StylePreset    string
+	Seed           int64
+	CfgScale       float64
+	Steps          int
+	Width          int
+	Height         int
+	RequestID      string
+}
+
+// imageMetadata is the Metadata of an image generated from payload
+func imageMetadata(payload *GenerateRequest) Metadata {
+	return Metadata{
+		Prompt:         payload.Prompt,
+		NegativePrompt: payload.NegativePrompt,
+		Model:          payload.Model,
+		StylePreset:    payload.StylePreset,
+		Seed:           payload.Seed,
+		CfgScale:       payload.CfgScale,
+		Steps:          payload.Steps,
+		Width:          payload.Width,
+		Height:         payload.Height,
+		RequestID:      payload.RequestID,
+	}
+}
+
+// ImageSink is somewhere finished images are written to, by name. Save returns an error
+// when the image didn't arrive intact, so the caller can generate it again.
+type ImageSink interface {
+	Save(ctx context.Context, name string, data []byte, meta Metadata) error
+}
+
+// fileSink writes images to the local filesystem, name being the file path. What landed
+// on disk is read back so a truncated write doesn't litter the output dir.
+type fileSink struct{}
+
+func (fileSink) Save(ctx context.Context, name string, data []byte, meta Metadata) error {
+	if err := os.WriteFile(name, data, 0644); err != nil {
+		return err
+	}
+	if err := verifyImageFile(name); err != nil {
+		os.Remove(name)
+		return fmt.Errorf("saved image failed verification: %v", err)
+	}
+	return nil
+}
+
+// localSink is where images are first written, so they can be verified and encoded
+var localSink ImageSink = fileSink{}
+
+// publishTarget is a sink every finished image is also sent to, e.g. an S3 bucket
+type publishTarget struct {
+	sink      ImageSink
+	base      string // where names sent to the sink end up, e.g. "s3://bucket/prefix/"
+	keepLocal bool   // keep the local file once the image is in the sink
+}
+
+// publishTargets is empty unless the images go somewhere besides the output folder
+var publishTargets []publishTarget
+
+// setupUploads turns on uploading when the config has an s3 block
+func setupUploads(config *PromptConfig) error {
+	if config.S3 == nil {
+		return nil
+	}
+	sink, err := newS3Sink(config.S3)
+	if err != nil {
+		return err
+	}
+	publishTargets = append(publishTargets, publishTarget{
+		sink:      sink,
+		base:      "s3://" + sink.bucket + "/" + sink.prefix,
+		keepLocal: config.S3.KeepLocal,
+	})
+	return nil
+}
+
+// imageKey is an image's name in a publish target: its path within the output folder,
+// under the prompt's folder when each prompt has its own, with forward slashes
+func imageKey(path string, config *PromptConfig) string {
+	rel, err := filepath.Rel(config.OutputDir, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		rel = filepath.Base(path)
+	}
+	if config.NameAsSubDir {
+		rel = filepath.Join(filepath.Base(config.OutputDir), rel)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// publishImage sends a finished image to every publish target, then removes the local
+// copy unless a target keeps it. When any target fails the local file is kept so nothing
+// is lost. It returns where the image ended up.
+func publishImage(path string, config *PromptConfig, meta Metadata) string {
+	if len(publishTargets) == 0 {
+		return path
+	}
+	key := imageKey(path, config)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		displayError("Error reading %s to publish it: %v", path, err)
+		return path
+	}
+
+	keep, location := false, path
+	for n, target := range publishTargets {
+		if err := target.sink.Save(runCtx, key, data, meta); err != nil {
+			displayError("Saving to %s failed, keeping the local file: %v", target.base, err)
+			updatePromptLog([]string{"\nPublish:     failed for ", target.base, ", kept local file"})
+			keep = true
+			continue
+		}
+		debugLog("Saved %s", target.base+key)
+		updatePromptLog([]string{"\nSaved to:    ", target.base + key})
+		keep = keep || target.keepLocal
+		if n == 0 {
+			location = target.base + key
+		}
+	}
+	if keep {
+		return path
+	}
+	os.Remove(path)
+	return location
+}
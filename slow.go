@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// slowStreak counts requests in a row that ran past SoftTimeout
+var slowStreak = 0
+
+// softTimeout returns how long a request may take before it is reported as slow (0 = never)
+func (config *PromptConfig) softTimeout() time.Duration {
+	if config.SoftTimeout == "" {
+		return 0
+	}
+	soft, err := time.ParseDuration(config.SoftTimeout)
+	if err != nil || soft <= 0 {
+		return 0
+	}
+	return soft
+}
+
+// watchSlowRequest returns a copy of req that is flagged as slow once it passes the soft
+// timeout. After SlowCancelAfter slow requests in a row a slow request is cancelled
+// instead so it can be retried. The returned func stops the watch and reports whether
+// the request was slow and whether it was cancelled.
+func watchSlowRequest(req *http.Request, config *PromptConfig) (*http.Request, func() (bool, bool)) {
+	soft := config.softTimeout()
+	if soft == 0 {
+		return req, func() (bool, bool) { return false, false }
+	}
+
+	ctx, cancel := context.WithCancel(req.Context())
+	cancelSlow := config.SlowCancelAfter > 0 && slowStreak >= config.SlowCancelAfter
+
+	var slow, cancelled atomic.Bool
+	timer := time.AfterFunc(soft, func() {
+		slow.Store(true)
+		if cancelSlow {
+			cancelled.Store(true)
+			cancel()
+			return
+		}
+		showStatus(fmt.Sprintf("Slow request - no response after %s, still waiting...", soft))
+		debugLog("Slow request: no response after %s", soft)
+	})
+
+	return req.WithContext(ctx), func() (bool, bool) {
+		timer.Stop()
+		cancel()
+		if slow.Load() {
+			slowStreak++
+		} else {
+			slowStreak = 0
+		}
+		return slow.Load(), cancelled.Load()
+	}
+}
+
+// showStatus replaces the status shown in the progress display without redrawing the rest
+func showStatus(status string) {
+	if quietMode {
+		return
+	}
+	if *barMode {
+		printProgressBar(barCurrent, barTotal, status)
+		return
+	}
+	// The status is the fifth line of the full-screen display
+	fmt.Printf("\033[5;0HStatus:   %s\033[K\033[H", colorize(currentConfig(), ColorYellow, status))
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ETA_WINDOW is how many recent per-image times the ETA takes the median of
+const ETA_WINDOW = 10
+
+// RunStats holds the counters for the current run. Every change goes through its
+// methods, which are safe to call from the webhook and signal goroutines.
+type RunStats struct {
+	mu sync.Mutex
+
+	stored    int // images written
+	failed    int // failed attempts, as shown in the progress display
+	blocked   int // prompts the API refused
+	abandoned int // images given up on after MaxIndexAttempts
+	retries   int // request retries, checked against RetryBudget
+	penalty   int // failures counted towards MaxFailures, forgiven by success streaks
+	streak    int // images stored since the last failure, checked against FailureResetAfter
+	decayRun  int // images stored since the last failure or decay, checked against FailureDecay
+	decoding  int // base64 decode failures since the last stored image
+
+	images []ProducedImage
+
+	lastSuccess time.Time       // when the last image was stored
+	troubled    bool            // a failure or retry happened since lastSuccess
+	imageTimes  []time.Duration // recent clean per-image times for the ETA
+}
+
+// ProducedImage is a file written by the run
+type ProducedImage struct {
+	File string `json:"file"`
+	Seed int64  `json:"seed"`
+}
+
+// stats are the counters of the run in progress
+var stats = &RunStats{}
+
+func (s *RunStats) RecordFailure() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed++
+	s.penalty++
+	s.streak, s.decayRun = 0, 0
+	s.troubled = true
+}
+
+// RecordDecodeFailure records a failure caused by undecodable image data and returns how
+// many there have been in a row
+func (s *RunStats) RecordDecodeFailure() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failed++
+	s.penalty++
+	s.streak, s.decayRun = 0, 0
+	s.decoding++
+	s.troubled = true
+	return s.decoding
+}
+
+// RecordSuccess counts a stored image and forgives one failure after every streak of
+// FailureDecay successes so scattered transient failures in a long run don't add up to an
+// abort. A streak of FailureResetAfter successes forgives all of them.
+func (s *RunStats) RecordSuccess(config *PromptConfig) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.stored++
+	s.decoding = 0
+	s.streak++
+	s.decayRun++
+	s.recordImageTime()
+
+	if config.FailureResetAfter > 0 && s.streak >= config.FailureResetAfter {
+		s.penalty = 0
+		s.streak, s.decayRun = 0, 0
+		return
+	}
+
+	decay := config.FailureDecay
+	if decay <= 0 {
+		decay = DefaultFailureDecay
+	}
+	if s.decayRun >= decay && s.penalty > 0 {
+		s.penalty--
+		s.decayRun = 0
+	}
+}
+
+// recordImageTime adds the time since the previous image (or the start of the run) to the
+// ETA window. Images that needed retries are left out. Called with s.mu held.
+func (s *RunStats) recordImageTime() {
+	now := time.Now()
+	since := s.lastSuccess
+	if since.IsZero() {
+		since = runStarted
+	}
+	troubled := s.troubled
+	s.lastSuccess, s.troubled = now, false
+
+	if since.IsZero() || troubled {
+		return
+	}
+	s.imageTimes = append(s.imageTimes, now.Sub(since))
+	if len(s.imageTimes) > ETA_WINDOW {
+		s.imageTimes = s.imageTimes[1:]
+	}
+}
+
+// medianImageTime is the median of the ETA window. One slow image doesn't move it, while
+// the API slowing down for good does once it makes up most of the window.
+func (s *RunStats) medianImageTime() time.Duration {
+	if len(s.imageTimes) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), s.imageTimes...)
+	sort.Slice(sorted, func(a, b int) bool { return sorted[a] < sorted[b] })
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// ETA estimates how long the remaining images will take from the recent per-image times.
+// It reports false until an image has been timed.
+func (s *RunStats) ETA(remaining int) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	median := s.medianImageTime()
+	if median == 0 {
+		return 0, false
+	}
+	return median * time.Duration(remaining), true
+}
+
+// ResetFailures forgives every failure counted towards MaxFailures
+func (s *RunStats) ResetFailures() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.penalty = 0
+	s.streak, s.decayRun = 0, 0
+}
+
+// RecordImage notes a file written to disk for the run summary
+func (s *RunStats) RecordImage(file string, seed int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.images = append(s.images, ProducedImage{file, seed})
+}
+
+// RecordBlocked counts a prompt rejected by the API
+func (s *RunStats) RecordBlocked() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blocked++
+}
+
+// RecordAbandoned counts an image given up on after too many attempts
+func (s *RunStats) RecordAbandoned() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.abandoned++
+}
+
+func (s *RunStats) RecordRetry() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries++
+	s.troubled = true
+}
+
+// ResetAllowance gives a new batch (a queue entry or a preview) a fresh failure and
+// retry allowance. The stored and failed totals are kept for the run summary.
+func (s *RunStats) ResetAllowance() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.retries = 0
+	s.penalty = 0
+	s.streak, s.decayRun = 0, 0
+	s.decoding = 0
+	s.lastSuccess = time.Time{}
+}
+
+func (s *RunStats) Stored() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stored
+}
+
+func (s *RunStats) Failed() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.failed
+}
+
+func (s *RunStats) Retries() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.retries
+}
+
+func (s *RunStats) Penalty() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.penalty
+}
+
+func (s *RunStats) Blocked() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.blocked
+}
+
+func (s *RunStats) Abandoned() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.abandoned
+}
+
+// Images returns a copy of the files written so far
+func (s *RunStats) Images() []ProducedImage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ProducedImage(nil), s.images...)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+)
+
+// AbortStop is the abortReason after the stop file appeared
+const AbortStop = "stop file found"
+
+// stopFilePath is the file whose appearance stops the run gracefully, empty to disable it
+var stopFilePath string
+
+// setStopFile resolves -stop-file, defaulting to ~/.venice/stop
+func setStopFile(currentUser *user.User) {
+	stopFilePath = filepath.Join(currentUser.HomeDir, ".venice", "stop")
+	if *stopFile != "" {
+		stopFilePath = expandPath(*stopFile, currentUser.HomeDir)
+	}
+}
+
+// stopRequested reports whether the stop file has appeared. The run then stops like any
+// other abort once the current image is done, and the file is removed so the next run
+// isn't stopped straight away.
+func stopRequested() bool {
+	if abortReason == AbortStop {
+		return true
+	}
+	if stopFilePath == "" {
+		return false
+	}
+	if _, err := os.Stat(stopFilePath); err != nil {
+		return false
+	}
+
+	if err := os.Remove(stopFilePath); err != nil {
+		displayError("Error removing stop file: %v", err)
+	}
+	abortReason = AbortStop
+	updatePromptLog([]string{fmt.Sprintf("\n\nStopping: %s was found", stopFilePath)})
+	return true
+}
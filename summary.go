@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+// RunSummary is printed as a single line of JSON at the end of a -json run
+type RunSummary struct {
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	Blocked   int             `json:"blocked"`
+	Abandoned int             `json:"abandoned"`
+	Stopped   string          `json:"stopped,omitempty"`
+	OutputDir string          `json:"output_dir"`
+	Elapsed   float64         `json:"elapsed_seconds"`
+	Images    []ProducedImage `json:"images"`
+}
+
+// printRunSummary writes the run summary to stdout, or stderr when stdout carries the image
+func printRunSummary(config *PromptConfig) {
+	images := stats.Images()
+	if images == nil {
+		images = []ProducedImage{}
+	}
+
+	summary := RunSummary{
+		Succeeded: stats.Stored(),
+		Failed:    stats.Failed(),
+		Blocked:   stats.Blocked(),
+		Abandoned: stats.Abandoned(),
+		Stopped:   abortReason,
+		OutputDir: config.OutputDir,
+		Elapsed:   time.Since(runStarted).Round(time.Millisecond).Seconds(),
+		Images:    images,
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		return
+	}
+
+	var out io.Writer = os.Stdout
+	if *toStdout {
+		out = os.Stderr
+	}
+	fmt.Fprintln(out, string(data))
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// categoryToggle returns the Enable* field for a category name as used on the command
+// line, or nil when the name is unknown
+func (config *PromptConfig) categoryToggle(name string) *bool {
+	switch strings.ToLower(name) {
+	case "face":
+		return &config.EnableFace
+	case "type":
+		return &config.EnableType
+	case "hair":
+		return &config.EnableHair
+	case "eyes":
+		return &config.EnableEyes
+	case "clothing":
+		return &config.EnableClothing
+	case "background", "backgrounds":
+		return &config.EnableBackground
+	case "poses":
+		return &config.EnablePoses
+	case "accessories":
+		return &config.EnableAccessories
+	case "dirty":
+		return &config.EnableDirty
+	case "style":
+		return &config.Style
+	default:
+		return nil
+	}
+}
+
+// categoryNames are the names accepted by -enable and -disable
+var categoryNames = []string{"face", "type", "hair", "eyes", "clothing", "background", "poses", "accessories", "dirty", "style"}
+
+// checkCategoryFlags validates the -enable and -disable lists, rejecting unknown names
+// and categories given to both
+func checkCategoryFlags() error {
+	enabled, err := splitCategories(*enableCategories)
+	if err != nil {
+		return err
+	}
+	disabled, err := splitCategories(*disableCategories)
+	if err != nil {
+		return err
+	}
+	// Aliases such as background/backgrounds share a toggle, so compare the toggles
+	var probe PromptConfig
+	for _, e := range enabled {
+		for _, d := range disabled {
+			if probe.categoryToggle(e) == probe.categoryToggle(d) {
+				return fmt.Errorf("%q is both enabled and disabled", e)
+			}
+		}
+	}
+	return nil
+}
+
+// splitCategories splits a comma separated -enable/-disable list, rejecting unknown names
+func splitCategories(list string) ([]string, error) {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if (&PromptConfig{}).categoryToggle(name) == nil {
+			return nil, fmt.Errorf("unknown category %q (expected one of %s)", name, strings.Join(categoryNames, ", "))
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// applyCategoryFlags applies -enable, -disable and -no-style on top of the config's
+// Enable* settings
+func applyCategoryFlags(config *PromptConfig) {
+	setStyle := func(enabled bool) {
+		config.Style = enabled
+		if enabled && config.StyleMode == "none" {
+			config.StyleMode = ""
+		} else if !enabled {
+			config.StyleMode = "none"
+		}
+	}
+
+	enabled, _ := splitCategories(*enableCategories)
+	for _, name := range enabled {
+		if strings.EqualFold(name, "style") {
+			setStyle(true)
+			continue
+		}
+		*config.categoryToggle(name) = true
+	}
+
+	disabled, _ := splitCategories(*disableCategories)
+	for _, name := range disabled {
+		if strings.EqualFold(name, "style") {
+			setStyle(false)
+			continue
+		}
+		*config.categoryToggle(name) = false
+	}
+
+	if *noStyle {
+		setStyle(false)
+	}
+
+	config.setDisplaySettings()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"slices"
+	"strings"
+)
+
+// elementDeck deals a category's elements in a shuffled order without repeats, shuffling
+// them again once every element has been used
+type elementDeck struct {
+	items []string // the elements the deck was built from, to notice a reload
+	queue []string // elements still to be dealt
+	last  string   // the previous element, kept from starting the next round
+}
+
+// elementDecks holds the decks of the categories in UniqueAcrossBatch for the current batch
+var elementDecks = make(map[string]*elementDeck)
+
+// resetElementDecks starts every deck afresh for a new batch
+func resetElementDecks() {
+	elementDecks = make(map[string]*elementDeck)
+}
+
+// uniqueAcrossBatch reports whether the named category is drawn without replacement
+func (config *PromptConfig) uniqueAcrossBatch(name string) bool {
+	for key, unique := range config.UniqueAcrossBatch {
+		if strings.EqualFold(key, name) {
+			return unique
+		}
+	}
+	return false
+}
+
+// pickElement returns an element of the named category: the next one from its deck when
+// the category is in UniqueAcrossBatch, otherwise an independent random pick
+func (config *PromptConfig) pickElement(name string, items []string) string {
+	if len(items) == 0 || !config.uniqueAcrossBatch(name) {
+		return getRandomItem(items)
+	}
+
+	key := strings.ToLower(name)
+	deck := elementDecks[key]
+	if deck == nil || !slices.Equal(deck.items, items) {
+		deck = &elementDeck{items: slices.Clone(items)}
+		elementDecks[key] = deck
+	}
+	if len(deck.queue) == 0 {
+		deck.queue = shuffledItems(items)
+		// Don't repeat the last element of one round as the first of the next
+		if len(deck.queue) > 1 && deck.queue[0] == deck.last {
+			deck.queue[0], deck.queue[1] = deck.queue[1], deck.queue[0]
+		}
+	}
+
+	item := deck.queue[0]
+	deck.queue = deck.queue[1:]
+	deck.last = item
+	return item
+}
+
+// shuffledItems returns a copy of items in a random order from the element selection
+// source, so an enhance_seed reproduces it
+func shuffledItems(items []string) []string {
+	shuffled := slices.Clone(items)
+	for i := len(shuffled) - 1; i > 0; i-- {
+		j := selectionIntn(i + 1)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	return shuffled
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+type validationCheck struct {
+	name string
+	err  error
+}
+
+// validateConfig runs every config check on the prompt config at configPath (stdin when
+// it is "") without touching the API, prints a pass/fail report and returns the process
+// exit code
+func validateConfig(configPath string) int {
+	var checks []validationCheck
+	check := func(name string, err error) {
+		checks = append(checks, validationCheck{name, err})
+	}
+
+	currentUser, err := user.Current()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error getting current user: %v\n", err)
+		return 1
+	}
+	veniceDir := filepath.Join(currentUser.HomeDir, ".venice")
+
+	var config PromptConfig
+	var promptData []byte
+	source := configPath
+	if configPath == "" {
+		source = "config from stdin"
+		promptData, err = io.ReadAll(os.Stdin)
+	} else {
+		promptData, err = os.ReadFile(configPath)
+	}
+	if err == nil {
+		err = json.Unmarshal(promptData, &config)
+	}
+	check(source+" parses", err)
+	configOK := err == nil
+
+	elements, err := loadElementsFile(filepath.Join(veniceDir, "elements.json"), make(map[string]bool))
+	check("elements.json and its includes parse", err)
+	elementsOK := err == nil
+
+	if configOK {
+		check("API key present", checkAPIKey(&config))
+		check("Dimensions are multiples of 8", checkDimensions(&config))
+		check("Steps within range", checkSteps(&config))
+		check("CFG range", checkCfgRange(&config))
+		check("Steps and CFG accepted by the model", checkModelLimits(&config))
+		check("Prompt length", checkPromptLength(&config))
+		check("Directory template parses", checkDirTemplate(&config))
+		check("Collision strategy", checkCollisionStrategy(&config))
+		check("External encoder has a command", checkExternalEncoder(&config))
+		check("Output directory allowed", checkOutputDir(&config, currentUser))
+		if config.S3 != nil {
+			_, err := newS3Sink(config.S3)
+			check("S3 upload settings", err)
+		}
+	}
+
+	if configOK && elementsOK {
+		check("Enabled categories have elements", checkEnabledCategories(&config, elements))
+	}
+
+	failed := 0
+	for _, c := range checks {
+		if c.err != nil {
+			failed++
+			fmt.Printf("FAIL  %s: %v\n", c.name, c.err)
+		} else {
+			fmt.Printf("PASS  %s\n", c.name)
+		}
+	}
+
+	fmt.Println()
+	if failed > 0 {
+		fmt.Printf("%d of %d checks failed\n", failed, len(checks))
+		return 1
+	}
+	fmt.Printf("All %d checks passed\n", len(checks))
+	return 0
+}
+
+func checkAPIKey(config *PromptConfig) error {
+	if (config.APIKey == "" || config.APIKey == "YOUR_API_KEY") && len(config.APIKeys) == 0 {
+		return fmt.Errorf("no API key set")
+	}
+	return nil
+}
+
+func checkDimensions(config *PromptConfig) error {
+	if config.Width <= 0 || config.Height <= 0 {
+		return fmt.Errorf("width and height must be positive (got %dx%d)", config.Width, config.Height)
+	}
+	if config.Width%8 != 0 || config.Height%8 != 0 {
+		return fmt.Errorf("%dx%d is not a multiple of 8", config.Width, config.Height)
+	}
+	return nil
+}
+
+func checkSteps(config *PromptConfig) error {
+	if config.Steps < defaultLimits.MinSteps || config.Steps > defaultLimits.MaxSteps {
+		return fmt.Errorf("steps must be between %d and %d (got %d)",
+			defaultLimits.MinSteps, defaultLimits.MaxSteps, config.Steps)
+	}
+	return nil
+}
+
+func checkCfgRange(config *PromptConfig) error {
+	if config.MinConfig < 1 || config.MaxConfig > 20 {
+		return fmt.Errorf("min_config/max_config must be within 1-20 (got %.2f-%.2f)",
+			config.MinConfig, config.MaxConfig)
+	}
+	if config.MinConfig > config.MaxConfig {
+		return fmt.Errorf("min_config %.2f is greater than max_config %.2f",
+			config.MinConfig, config.MaxConfig)
+	}
+	if config.CfgScale != 0 && (config.CfgScale < 1 || config.CfgScale > 20) {
+		return fmt.Errorf("cfg_scale must be within 1-20 (got %.2f)", config.CfgScale)
+	}
+	if config.CfgIncrement < 0 {
+		return fmt.Errorf("cfg_increment must be positive (got %.2f)", config.CfgIncrement)
+	}
+	if spread := config.MaxConfig - config.MinConfig; config.CfgIncrement > spread && spread > 0 {
+		return fmt.Errorf("cfg_increment %.2f is larger than the %.2f-%.2f range",
+			config.CfgIncrement, config.MinConfig, config.MaxConfig)
+	}
+	if config.FixedCfg && (config.CfgScale < 1 || config.CfgScale > 20) {
+		return fmt.Errorf("fixed_cfg needs cfg_scale within 1-20 (got %.2f)", config.CfgScale)
+	}
+	return nil
+}
+
+func checkPromptLength(config *PromptConfig) error {
+	if len(config.Prompt) > MaxPromptLength {
+		return fmt.Errorf("prompt is %d characters, the maximum is %d", len(config.Prompt), MaxPromptLength)
+	}
+	return nil
+}
+
+func checkDirTemplate(config *PromptConfig) error {
+	_, err := expandDirTemplate(config.DirTemplate, config, time.Now())
+	return err
+}
+
+func checkOutputDir(config *PromptConfig, currentUser *user.User) error {
+	outputDir, err := baseOutputDirectory(config, currentUser)
+	if err != nil {
+		return err
+	}
+	return checkRestrictedOutput(outputDir, config, currentUser)
+}
+
+func checkCollisionStrategy(config *PromptConfig) error {
+	if config.CollisionStrategy != "" && config.collisionStrategy() != strings.ToLower(config.CollisionStrategy) {
+		return fmt.Errorf("unknown collision_strategy %q (use increment, timestamp, overwrite or skip)",
+			config.CollisionStrategy)
+	}
+	return nil
+}
+
+func checkExternalEncoder(config *PromptConfig) error {
+	if config.ExternalEncoder != "" && len(strings.Fields(config.ExternalEncoder)) == 0 {
+		return fmt.Errorf("external_encoder is set but contains only whitespace")
+	}
+	return nil
+}
+
+func checkEnabledCategories(config *PromptConfig, elements *PromptElements) error {
+	categories := []struct {
+		name    string
+		items   []string
+		enabled bool
+	}{
+		{"face", elements.Face, config.EnableFace},
+		{"type", elements.Type, config.EnableType},
+		{"hair", elements.Hair, config.EnableHair},
+		{"eyes", elements.Eyes, config.EnableEyes},
+		{"clothing", elements.Clothing, config.EnableClothing},
+		{"backgrounds", elements.Backgrounds, config.EnableBackground},
+		{"poses", elements.Poses, config.EnablePoses},
+		{"accessories", elements.Accessories, config.EnableAccessories},
+		{"style", elements.allStyles(), config.Style},
+	}
+
+	var empty []string
+	for _, category := range categories {
+		if category.enabled && len(category.items) == 0 {
+			empty = append(empty, category.name)
+		}
+	}
+	if len(empty) > 0 {
+		return fmt.Errorf("enabled but empty: %v", empty)
+	}
+	return nil
+}
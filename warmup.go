@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// batchStart is the index generateBatch starts at, so a batch can continue after the
+// -test image instead of numbering from the beginning again
+var batchStart = 0
+
+// continuingBatch makes generateBatch carry on after the -test image instead of starting
+// over: the element decks and selection sequence stay where the test image left them, and
+// the up-front choices in batchChoices are reused
+var continuingBatch bool
+
+// upFrontChoices are what generateBatch chooses once for the whole batch
+type upFrontChoices struct {
+	stylePreset, styleKeyword string // a seed sweep's style
+	pinnedRandos, pinnedDirty string // the elements fix_elements_per_batch pins
+}
+
+var batchChoices upFrontChoices
+
+// generateWithTest generates a single image first and only goes on with the rest of the
+// batch once the user has confirmed it worked, so a misconfiguration costs one image
+// instead of the whole run
+func generateWithTest(config *PromptConfig, elements *PromptElements, configPath string) {
+	total := config.NumImages
+	config.NumImages = 1
+	generateBatch(config, elements, "")
+	config = activeConfig
+	config.NumImages = total
+
+	if fullScreen() {
+		flushPromptLog()
+		leaveProgressDisplay(config)
+	} else if *barMode {
+		fmt.Println()
+	}
+
+	images := stats.Images()
+	if stats.Stored() == 0 || len(images) == 0 {
+		fmt.Println("❌ Test image failed, check the errors above and the Prompt Log before starting the batch")
+		abortReason = "test image failed"
+		return
+	}
+	fmt.Printf("✅ Test image saved to %s\n", images[len(images)-1].File)
+	if total <= 1 || interrupted {
+		return
+	}
+
+	if !confirm(fmt.Sprintf("Generate the remaining %d images?", total-1)) {
+		abortReason = "stopped after the test image"
+		return
+	}
+
+	resetRunCounters()
+	if fullScreen() {
+		fmt.Print("\033[H\033[2J")
+	}
+	batchStart, continuingBatch = 1, true
+	generateBatch(config, elements, configPath)
+}
+
+// confirm asks a yes/no question on stdin, defaulting to no
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
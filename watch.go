@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// How often prompt.json and elements.json are checked in -watch-config mode
+	WATCH_POLL = 500 * time.Millisecond
+	// How long the files have to stay unchanged before a preview is generated, so an
+	// editor writing a file in several steps only triggers one generation
+	WATCH_DEBOUNCE = time.Second
+)
+
+// fileStamp identifies a version of a file by modification time and size
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func statFiles(paths []string) []fileStamp {
+	stamps := make([]fileStamp, len(paths))
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			stamps[i] = fileStamp{info.ModTime(), info.Size()}
+		}
+	}
+	return stamps
+}
+
+func sameStamps(a, b []fileStamp) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].modTime.Equal(b[i].modTime) || a[i].size != b[i].size {
+			return false
+		}
+	}
+	return true
+}
+
+// watchConfigFiles generates a single preview image every time the prompt config at
+// configPath (prompt.json unless -config names another) or elements.json is saved, until
+// interrupted. Each preview uses freshly loaded files and is written to outputDir.
+func watchConfigFiles(baseConfig *PromptConfig, configPath string, currentUser *user.User) {
+	elementsPath := filepath.Join(currentUser.HomeDir, ".venice", "elements.json")
+	paths := []string{configPath, elementsPath}
+	// Files included by elements.json count as well, re-read as the include list changes
+	watched := func() []string {
+		return append(paths[:2:2], includedFiles(paths[1])...)
+	}
+
+	last := statFiles(watched())
+	waiting := false
+	for !interrupted && !stopRequested() {
+		if !waiting && !quietMode {
+			fmt.Printf("\nWatching %s and %s for changes ...\n", paths[0], paths[1])
+			waiting = true
+		}
+		time.Sleep(WATCH_POLL)
+
+		current := statFiles(watched())
+		if sameStamps(last, current) {
+			continue
+		}
+
+		// Let a burst of saves settle before generating
+		for {
+			time.Sleep(WATCH_DEBOUNCE)
+			settled := statFiles(watched())
+			if sameStamps(current, settled) {
+				break
+			}
+			current = settled
+		}
+		last = current
+		waiting = false
+
+		if err := generatePreview(baseConfig, paths[0]); err != nil {
+			displayError("Preview skipped: %v", err)
+		}
+	}
+}
+
+func generatePreview(baseConfig *PromptConfig, configPath string) error {
+	data, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("error reading %s: %v", configPath, err)
+	}
+	config, err := parseConfig(data, configPath)
+	if err != nil {
+		return err
+	}
+	elements, err := loadPromptElements()
+	if err != nil {
+		return err
+	}
+
+	config.OutputDir = baseConfig.OutputDir
+	config.NameAsSubDir = baseConfig.NameAsSubDir
+	if limits := limitsFor(config.Model); config.CfgScale < limits.MinCfg || config.CfgScale > limits.MaxCfg {
+		config.CfgScale = 8.5
+	}
+	applyFlagOverrides(config)
+	if err := checkModelLimits(config); err != nil {
+		displayError("Warning: %v, the nearest accepted value will be used", err)
+		limits := limitsFor(config.Model)
+		config.Steps = min(max(config.Steps, limits.MinSteps), limits.MaxSteps)
+	}
+	config.NumImages = 1
+
+	resetRunCounters()
+	if fullScreen() {
+		fmt.Print("\033[H\033[2J")
+	}
+	generateBatch(config, elements, "")
+	flushPromptLog()
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// webhookPayload is accepted by both Discord (content) and Slack (text) incoming
+// webhooks; the remaining fields are there for custom receivers
+type webhookPayload struct {
+	Content   string `json:"content"`
+	Text      string `json:"text"`
+	Event     string `json:"event"`
+	Succeeded int    `json:"succeeded"`
+	Failed    int    `json:"failed"`
+	OutputDir string `json:"output_dir"`
+	Elapsed   string `json:"elapsed"`
+}
+
+// runStarted is when the current batch began, for the elapsed time in notifications
+var runStarted = time.Now()
+
+// notifyWebhook posts a run summary to the configured webhook. It is best-effort with a
+// short timeout so a webhook outage never affects the run.
+func notifyWebhook(config *PromptConfig, event, message string) {
+	if config == nil || config.WebhookURL == "" {
+		return
+	}
+
+	elapsed := time.Since(runStarted).Round(time.Second)
+	succeeded, failed := stats.Stored(), stats.Failed()
+	summary := fmt.Sprintf("%s\n%d succeeded, %d failed in %s\nOutput: %s",
+		message, succeeded, failed, elapsed, config.OutputDir)
+
+	body, err := json.Marshal(webhookPayload{
+		Content:   summary,
+		Text:      summary,
+		Event:     event,
+		Succeeded: succeeded,
+		Failed:    failed,
+		OutputDir: config.OutputDir,
+		Elapsed:   elapsed.String(),
+	})
+	if err != nil {
+		return
+	}
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Post(config.WebhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}